@@ -3,12 +3,16 @@ package ast
 import (
 	"bytes"
 	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
 	"waiig/token"
 )
 
 type Node interface {
 	TokenLiteral() string
 	String() string
+	Pos() token.Position // position of the node's token in the input
 }
 type Statement interface {
 	Node
@@ -20,6 +24,7 @@ type Expression interface {
 }
 type Program struct {
 	Statements []Statement
+	Comments   []*Comment // only filled when the lexer produces comments
 }
 
 func (p *Program) TokenLiteral() string {
@@ -30,6 +35,13 @@ func (p *Program) TokenLiteral() string {
 	}
 }
 
+func (p *Program) Pos() token.Position {
+	if len(p.Statements) > 0 {
+		return p.Statements[0].Pos()
+	}
+	return token.Position{}
+}
+
 func (p *Program) String() string {
 	var out bytes.Buffer
 	for _, s := range p.Statements {
@@ -38,14 +50,26 @@ func (p *Program) String() string {
 	return out.String()
 }
 
+// Comment is a // or /* */ comment, it isn't part of the statements of a
+// program but kept next to them so tools can put it back
+type Comment struct {
+	Token token.Token // the token.COMMENT token
+}
+
+func (c *Comment) TokenLiteral() string { return c.Token.Literal }
+func (c *Comment) Pos() token.Position  { return c.Token.Pos }
+func (c *Comment) String() string       { return c.Token.Literal }
+
 type LetStatement struct {
 	Token token.Token // the token.LET token
 	Name  *Identifier
 	Value Expression
+	Doc   string // text of the /// comment lines right above the statement
 }
 
 func (ls *LetStatement) statementNode()       {}
 func (ls *LetStatement) TokenLiteral() string { return ls.Token.Literal }
+func (ls *LetStatement) Pos() token.Position  { return ls.Token.Pos }
 func (ls *LetStatement) String() string {
 	var out bytes.Buffer
 
@@ -67,6 +91,7 @@ type Identifier struct {
 
 func (i *Identifier) expressionNode()      {}
 func (i *Identifier) TokenLiteral() string { return i.Token.Literal }
+func (i *Identifier) Pos() token.Position  { return i.Token.Pos }
 func (i *Identifier) String() string       { return i.Value }
 
 type ReturnStatement struct {
@@ -76,6 +101,7 @@ type ReturnStatement struct {
 
 func (rs *ReturnStatement) statementNode()       {}
 func (rs *ReturnStatement) TokenLiteral() string { return rs.Token.Literal }
+func (rs *ReturnStatement) Pos() token.Position  { return rs.Token.Pos }
 func (rs *ReturnStatement) String() string {
 	var out bytes.Buffer
 
@@ -97,6 +123,7 @@ type ExpressionStatement struct {
 // and that's the whole reason why we're adding ExpressionStatement
 func (es *ExpressionStatement) statementNode()       {}
 func (es *ExpressionStatement) TokenLiteral() string { return es.Token.Literal }
+func (es *ExpressionStatement) Pos() token.Position  { return es.Token.Pos }
 func (es *ExpressionStatement) String() string {
 	var out bytes.Buffer
 
@@ -114,8 +141,29 @@ type IntegerLiteral struct {
 
 func (il *IntegerLiteral) expressionNode()      {}
 func (il *IntegerLiteral) TokenLiteral() string { return il.Token.Literal }
+func (il *IntegerLiteral) Pos() token.Position  { return il.Token.Pos }
 func (il *IntegerLiteral) String() string       { return fmt.Sprint(il.Value) }
 
+type FloatLiteral struct {
+	Token token.Token
+	Value float64
+}
+
+func (fl *FloatLiteral) expressionNode()      {}
+func (fl *FloatLiteral) TokenLiteral() string { return fl.Token.Literal }
+func (fl *FloatLiteral) Pos() token.Position  { return fl.Token.Pos }
+func (fl *FloatLiteral) String() string       { return FormatFloat(fl.Value) }
+
+// FormatFloat prints a float so that it reads back as one, 2.0 keeps its ".0".
+// Float values print the same way
+func FormatFloat(f float64) string {
+	s := strconv.FormatFloat(f, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eIN") {
+		s += ".0"
+	}
+	return s
+}
+
 type PrefixExpression struct {
 	Token    token.Token
 	Operator string
@@ -124,6 +172,7 @@ type PrefixExpression struct {
 
 func (pe *PrefixExpression) expressionNode()      {}
 func (pe *PrefixExpression) TokenLiteral() string { return pe.Token.Literal }
+func (pe *PrefixExpression) Pos() token.Position  { return pe.Token.Pos }
 func (pe *PrefixExpression) String() string {
 	return fmt.Sprintf("(%s%s)", pe.Operator, pe.Right.String())
 }
@@ -137,6 +186,7 @@ type InfixExpression struct {
 
 func (ie *InfixExpression) expressionNode()      {}
 func (ie *InfixExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *InfixExpression) Pos() token.Position  { return ie.Token.Pos }
 func (ie *InfixExpression) String() string {
 	return fmt.Sprintf("(%s %s %s)", ie.Left.String(), ie.Operator, ie.Right.String())
 }
@@ -148,15 +198,18 @@ type Boolean struct {
 
 func (b *Boolean) expressionNode()      {}
 func (b *Boolean) TokenLiteral() string { return b.Token.Literal }
+func (b *Boolean) Pos() token.Position  { return b.Token.Pos }
 func (b *Boolean) String() string       { return b.Token.Literal }
 
 type BlockStatement struct {
 	Token      token.Token // tke { token
 	Statements []Statement
+	End        token.Position // position of the closing }
 }
 
 func (bs *BlockStatement) expressionNode()      {}
 func (bs *BlockStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs *BlockStatement) Pos() token.Position  { return bs.Token.Pos }
 func (bs *BlockStatement) String() string {
 	var out bytes.Buffer
 
@@ -176,6 +229,7 @@ type IfExpression struct {
 
 func (ie *IfExpression) expressionNode()      {}
 func (ie *IfExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *IfExpression) Pos() token.Position  { return ie.Token.Pos }
 func (ie *IfExpression) String() string {
 	var out bytes.Buffer
 
@@ -191,3 +245,157 @@ func (ie *IfExpression) String() string {
 
 	return out.String()
 }
+
+type FunctionLiteral struct {
+	Token      token.Token // the 'fn' token
+	Parameters []*Identifier
+	Body       *BlockStatement
+	Name       string // name of the let binding the function is assigned to, if any
+}
+
+func (fl *FunctionLiteral) expressionNode()      {}
+func (fl *FunctionLiteral) TokenLiteral() string { return fl.Token.Literal }
+func (fl *FunctionLiteral) Pos() token.Position  { return fl.Token.Pos }
+func (fl *FunctionLiteral) String() string {
+	var out bytes.Buffer
+
+	params := []string{}
+	for _, p := range fl.Parameters {
+		params = append(params, p.String())
+	}
+
+	out.WriteString(fl.TokenLiteral())
+	out.WriteString("(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(") ")
+	out.WriteString(fl.Body.String())
+
+	return out.String()
+}
+
+type CallExpression struct {
+	Token     token.Token // the '(' token
+	Function  Expression  // Identifier or FunctionLiteral
+	Arguments []Expression
+}
+
+func (ce *CallExpression) expressionNode()      {}
+func (ce *CallExpression) TokenLiteral() string { return ce.Token.Literal }
+func (ce *CallExpression) Pos() token.Position  { return ce.Token.Pos }
+func (ce *CallExpression) String() string {
+	var out bytes.Buffer
+
+	args := []string{}
+	for _, a := range ce.Arguments {
+		args = append(args, a.String())
+	}
+
+	out.WriteString(ce.Function.String())
+	out.WriteString("(")
+	out.WriteString(strings.Join(args, ", "))
+	out.WriteString(")")
+
+	return out.String()
+}
+
+type StringLiteral struct {
+	Token token.Token
+	Value string
+}
+
+func (sl *StringLiteral) expressionNode()      {}
+func (sl *StringLiteral) TokenLiteral() string { return sl.Token.Literal }
+func (sl *StringLiteral) Pos() token.Position  { return sl.Token.Pos }
+func (sl *StringLiteral) String() string       { return quote(sl.Value) }
+
+// quote is the inverse of the escaping done by the lexer, so that the String()
+// of a program can be parsed again
+func quote(s string) string {
+	var out strings.Builder
+
+	out.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			out.WriteString(`\"`)
+		case '\\':
+			out.WriteString(`\\`)
+		case '\n':
+			out.WriteString(`\n`)
+		case '\t':
+			out.WriteString(`\t`)
+		case '\r':
+			out.WriteString(`\r`)
+		default:
+			if unicode.IsPrint(r) {
+				out.WriteRune(r)
+			} else {
+				fmt.Fprintf(&out, `\u{%x}`, r)
+			}
+		}
+	}
+	out.WriteByte('"')
+
+	return out.String()
+}
+
+type ArrayLiteral struct {
+	Token    token.Token // the '[' token
+	Elements []Expression
+}
+
+func (al *ArrayLiteral) expressionNode()      {}
+func (al *ArrayLiteral) TokenLiteral() string { return al.Token.Literal }
+func (al *ArrayLiteral) Pos() token.Position  { return al.Token.Pos }
+func (al *ArrayLiteral) String() string {
+	var out bytes.Buffer
+
+	elements := []string{}
+	for _, el := range al.Elements {
+		elements = append(elements, el.String())
+	}
+
+	out.WriteString("[")
+	out.WriteString(strings.Join(elements, ", "))
+	out.WriteString("]")
+
+	return out.String()
+}
+
+type IndexExpression struct {
+	Token token.Token // the '[' token
+	Left  Expression
+	Index Expression
+}
+
+func (ie *IndexExpression) expressionNode()      {}
+func (ie *IndexExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *IndexExpression) Pos() token.Position  { return ie.Token.Pos }
+func (ie *IndexExpression) String() string {
+	return fmt.Sprintf("(%s[%s])", ie.Left.String(), ie.Index.String())
+}
+
+type HashLiteral struct {
+	Token token.Token // the '{' token
+	// Keys and Values are kept in source order, so that String() is stable
+	Keys   []Expression
+	Values []Expression
+}
+
+func (hl *HashLiteral) expressionNode()      {}
+func (hl *HashLiteral) TokenLiteral() string { return hl.Token.Literal }
+func (hl *HashLiteral) Pos() token.Position  { return hl.Token.Pos }
+func (hl *HashLiteral) String() string {
+	var out bytes.Buffer
+
+	pairs := []string{}
+	for i, key := range hl.Keys {
+		pairs = append(pairs, key.String()+": "+hl.Values[i].String())
+	}
+
+	out.WriteString("{")
+	out.WriteString(strings.Join(pairs, ", "))
+	out.WriteString("}")
+
+	return out.String()
+}
@@ -26,3 +26,50 @@ func TestString(t *testing.T) {
 		t.Errorf("program.String() wrong, got=%q", program.String())
 	}
 }
+
+func TestTree(t *testing.T) {
+	program := &Program{
+		Statements: []Statement{
+			&LetStatement{
+				Token: token.Token{Type: token.LET, Literal: "let"},
+				Name:  &Identifier{Token: token.Token{Type: token.IDENT, Literal: "add"}, Value: "add"},
+				Value: &FunctionLiteral{
+					Token: token.Token{Type: token.FUNCTION, Literal: "fn"},
+					Name:  "add",
+					Parameters: []*Identifier{
+						{Token: token.Token{Type: token.IDENT, Literal: "a"}, Value: "a"},
+						{Token: token.Token{Type: token.IDENT, Literal: "b"}, Value: "b"},
+					},
+					Body: &BlockStatement{
+						Token: token.Token{Type: token.LBRACE, Literal: "{"},
+						Statements: []Statement{
+							&ExpressionStatement{
+								Token: token.Token{Type: token.IDENT, Literal: "a"},
+								Expression: &InfixExpression{
+									Token:    token.Token{Type: token.PLUS, Literal: "+"},
+									Left:     &Identifier{Token: token.Token{Type: token.IDENT, Literal: "a"}, Value: "a"},
+									Operator: "+",
+									Right:    &IntegerLiteral{Token: token.Token{Type: token.INT, Literal: "1"}, Value: 1},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	expected := `Program
+  LetStatement add
+    FunctionLiteral add(a, b)
+      BlockStatement
+        ExpressionStatement
+          InfixExpression +
+            Identifier a
+            IntegerLiteral 1
+`
+
+	if Tree(program) != expected {
+		t.Errorf("Tree(program) wrong.\nwant=%q\ngot =%q", expected, Tree(program))
+	}
+}
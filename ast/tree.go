@@ -0,0 +1,134 @@
+package ast
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// Tree renders node and everything below it as an indented outline, one node
+// per line, which is easier to follow than String() for nested expressions
+func Tree(node Node) string {
+	var out bytes.Buffer
+	writeTree(&out, node, 0)
+	return out.String()
+}
+
+func writeTree(out *bytes.Buffer, node Node, depth int) {
+	label, children := describe(node)
+
+	out.WriteString(strings.Repeat("  ", depth))
+	out.WriteString(label)
+	out.WriteString("\n")
+
+	for _, child := range children {
+		writeTree(out, child, depth+1)
+	}
+}
+
+// describe returns the line shown for node and the nodes nested in it
+func describe(node Node) (string, []Node) {
+	switch node := node.(type) {
+	case *Program:
+		children := []Node{}
+		for _, s := range node.Statements {
+			children = append(children, s)
+		}
+		return "Program", children
+
+	case *LetStatement:
+		return "LetStatement " + node.Name.Value, nonNil(node.Value)
+
+	case *ReturnStatement:
+		return "ReturnStatement", nonNil(node.Value)
+
+	case *ExpressionStatement:
+		return "ExpressionStatement", nonNil(node.Expression)
+
+	case *BlockStatement:
+		children := []Node{}
+		for _, s := range node.Statements {
+			children = append(children, s)
+		}
+		return "BlockStatement", children
+
+	case *Identifier:
+		return "Identifier " + node.Value, nil
+
+	case *IntegerLiteral:
+		return fmt.Sprintf("IntegerLiteral %d", node.Value), nil
+
+	case *FloatLiteral:
+		return "FloatLiteral " + FormatFloat(node.Value), nil
+
+	case *Boolean:
+		return fmt.Sprintf("Boolean %t", node.Value), nil
+
+	case *StringLiteral:
+		return "StringLiteral " + quote(node.Value), nil
+
+	case *PrefixExpression:
+		return "PrefixExpression " + node.Operator, nonNil(node.Right)
+
+	case *InfixExpression:
+		return "InfixExpression " + node.Operator, nonNil(node.Left, node.Right)
+
+	case *IfExpression:
+		children := nonNil(node.Condition)
+		if node.Consequence != nil {
+			children = append(children, node.Consequence)
+		}
+		if node.Alternative != nil {
+			children = append(children, node.Alternative)
+		}
+		return "IfExpression", children
+
+	case *FunctionLiteral:
+		params := []string{}
+		for _, p := range node.Parameters {
+			params = append(params, p.Value)
+		}
+		label := "FunctionLiteral"
+		if node.Name != "" {
+			label += " " + node.Name
+		}
+		label += "(" + strings.Join(params, ", ") + ")"
+
+		if node.Body == nil {
+			return label, nil
+		}
+		return label, []Node{node.Body}
+
+	case *CallExpression:
+		children := nonNil(node.Function)
+		children = append(children, nonNil(node.Arguments...)...)
+		return "CallExpression", children
+
+	case *ArrayLiteral:
+		return "ArrayLiteral", nonNil(node.Elements...)
+
+	case *IndexExpression:
+		return "IndexExpression", nonNil(node.Left, node.Index)
+
+	case *HashLiteral:
+		children := []Node{}
+		for i, key := range node.Keys {
+			children = append(children, nonNil(key, node.Values[i])...)
+		}
+		return "HashLiteral", children
+
+	default:
+		return fmt.Sprintf("%T", node), nil
+	}
+}
+
+// nonNil drops the expressions the parser couldn't make sense of
+func nonNil(exps ...Expression) []Node {
+	nodes := []Node{}
+	for _, e := range exps {
+		if e != nil {
+			nodes = append(nodes, e)
+		}
+	}
+	return nodes
+}
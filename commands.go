@@ -0,0 +1,342 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+	"waiig/ast"
+	"waiig/evaluator"
+	"waiig/format"
+	"waiig/lexer"
+	"waiig/object"
+	"waiig/parser"
+	"waiig/repl"
+	"waiig/token"
+	"waiig/web/webrepl"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"github.com/labstack/gommon/bytes"
+)
+
+func runCmd(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := newFlagSet("run", "file.mk [arguments]", stderr)
+	engine := flags.String("engine", string(repl.EngineEval), "backend that runs the program, eval or vm")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return exitUsage
+	}
+	path := flags.Arg(0)
+
+	if *engine != string(repl.EngineEval) && *engine != string(repl.EngineVM) {
+		fmt.Fprintf(stderr, "run: unknown engine %q\n", *engine)
+		return exitUsage
+	}
+
+	_, program, code := parseFile(path, stderr)
+	if program == nil {
+		return code
+	}
+
+	session := repl.NewSession(repl.Engine(*engine))
+	session.SetOutput(stdout)
+	session.Set("exit", exitBuiltin)
+
+	scriptArgs := &object.Array{Elements: []object.Object{}}
+	for _, arg := range flags.Args()[1:] {
+		scriptArgs.Elements = append(scriptArgs.Elements, &object.String{Value: arg})
+	}
+	session.Set("args", scriptArgs)
+
+	return runScript(session, program, path, stderr)
+}
+
+// exitCode is what the exit builtin panics with to stop the script wherever
+// it is, runScript recovers it
+type exitCode int
+
+var exitBuiltin = &object.Builtin{
+	Name:  "exit",
+	Arity: 1,
+	Types: [][]object.ObjectType{{object.INTEGER_OBJ}},
+	Fn: func(args ...object.Object) object.Object {
+		// the status is a byte, anything else would be cut down to one that
+		// may mean success
+		code := args[0].(*object.Integer).Value
+		if code < 0 || code > 255 {
+			return object.NewError("exit code has to be between 0 and 255, got %d", code)
+		}
+		panic(exitCode(code))
+	},
+}
+
+func runScript(session *repl.Session, program *ast.Program, path string, stderr io.Writer) (code int) {
+	defer func() {
+		if r := recover(); r != nil {
+			exit, ok := r.(exitCode)
+			if !ok {
+				panic(r)
+			}
+			code = int(exit)
+		}
+	}()
+
+	switch err := session.Eval(program).(type) {
+	case *object.Error:
+		printError(stderr, path, err.Pos, err.Message+err.Trace())
+		return exitError
+	case *object.LimitError:
+		printError(stderr, path, err.Pos, err.Message+err.Trace())
+		return exitError
+	}
+
+	return exitOK
+}
+
+// printError reports an error in the script at path, with the position when
+// the error has one
+func printError(w io.Writer, path string, pos token.Position, message string) {
+	if pos.IsValid() {
+		fmt.Fprintf(w, "%s:%s: %s\n", path, pos, message)
+	} else {
+		fmt.Fprintf(w, "%s: %s\n", path, message)
+	}
+}
+
+func replCmd(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := newFlagSet("repl", "", stderr)
+	engine := flags.String("engine", string(repl.EngineEval), "backend that runs the input, eval or vm")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if flags.NArg() != 0 {
+		flags.Usage()
+		return exitUsage
+	}
+
+	if *engine != string(repl.EngineEval) && *engine != string(repl.EngineVM) {
+		fmt.Fprintf(stderr, "repl: unknown engine %q\n", *engine)
+		return exitUsage
+	}
+
+	repl.Start(stdin, stdout, repl.Engine(*engine))
+	return exitOK
+}
+
+func serveCmd(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := newFlagSet("serve", "", stderr)
+	addr := flags.String("addr", ":8080", "address the web REPL listens on")
+	idle := flags.Duration("idle", 30*time.Minute, "how long an unused session is kept")
+	maxSessions := flags.Int("max-sessions", 1000, "number of sessions kept at most")
+	maxSessionBytes := flags.Int64("max-session", 64<<20, "rough bytes the bindings of a session may keep, 0 for no limit")
+	var limits evaluator.Limits
+	flags.Int64Var(&limits.MaxSteps, "max-steps", 10_000_000, "nodes a single input may evaluate, 0 for no limit")
+	flags.DurationVar(&limits.Timeout, "timeout", 5*time.Second, "time a single input may run, 0 for no limit")
+	flags.IntVar(&limits.MaxCallDepth, "max-depth", 1000, "nested function calls a single input may make, 0 for the default")
+	flags.IntVar(&limits.MaxNesting, "max-nesting", 0, "nodes a single input may evaluate inside each other, 0 for the default")
+	flags.Int64Var(&limits.MaxAllocBytes, "max-alloc", 64<<20, "rough bytes a single input may allocate, 0 for no limit")
+	maxBody := flags.String("max-body", "64K", "largest request body accepted, like 64K or 1M")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if flags.NArg() != 0 {
+		flags.Usage()
+		return exitUsage
+	}
+
+	if *maxSessions < 1 {
+		fmt.Fprintln(stderr, "serve: -max-sessions must be at least 1")
+		return exitUsage
+	}
+	if _, err := bytes.Parse(*maxBody); err != nil {
+		fmt.Fprintf(stderr, "serve: invalid -max-body %q\n", *maxBody)
+		return exitUsage
+	}
+
+	h := webrepl.NewHandler(webrepl.NewStore(*idle, *maxSessions, *maxSessionBytes), limits)
+	server := newServer(h, *maxBody)
+
+	fmt.Fprintf(stdout, "serving the web REPL on %s\n", *addr)
+	if err := server.Start(*addr); err != nil {
+		fmt.Fprintf(stderr, "serve: %s\n", err)
+		return exitError
+	}
+	return exitOK
+}
+
+// newServer routes the web REPL. Bodies are limited before anything reads
+// them, input that is too large never gets to the parser
+func newServer(h *webrepl.Handler, maxBody string) *echo.Echo {
+	server := echo.New()
+	server.HideBanner = true
+	server.Use(middleware.BodyLimit(maxBody))
+
+	server.GET("/", h.HandleIndex)
+	server.POST("/", h.HandleEvaluate)
+	server.POST("/reset", h.HandleReset)
+	return server
+}
+
+func tokensCmd(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := newFlagSet("tokens", "file.mk", stderr)
+	comments := flags.Bool("comments", false, "print comments as tokens too")
+	path, code := parseFlags(flags, args, stderr)
+	if code != exitOK {
+		return code
+	}
+
+	// the tokens are printed as they're read, so a - for stdin can be a pipe
+	// that is still being written to
+	input := stdin
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			fmt.Fprintf(stderr, "tokens: %s\n", err)
+			return exitError
+		}
+		defer file.Close()
+		input = file
+	}
+
+	opts := []lexer.Option{}
+	if *comments {
+		opts = append(opts, lexer.WithComments())
+	}
+
+	l := lexer.NewReader(input, opts...)
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		fmt.Fprintf(stdout, "%s\t%s\t%q\n", tok.Pos, tok.Type, tok.Literal)
+	}
+
+	if len(l.Errors()) != 0 {
+		for _, err := range l.Errors() {
+			fmt.Fprintf(stderr, "%s:%s\n", path, err)
+		}
+		return exitError
+	}
+	return exitOK
+}
+
+func astCmd(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := newFlagSet("ast", "file.mk", stderr)
+	tree := flags.Bool("tree", false, "print the syntax tree instead of the parsed source")
+	path, code := parseFlags(flags, args, stderr)
+	if code != exitOK {
+		return code
+	}
+
+	_, program, code := parseFile(path, stderr)
+	if program == nil {
+		return code
+	}
+
+	if *tree {
+		fmt.Fprint(stdout, ast.Tree(program))
+	} else {
+		fmt.Fprintln(stdout, program.String())
+	}
+	return exitOK
+}
+
+func fmtCmd(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := newFlagSet("fmt", "file.mk", stderr)
+	write := flags.Bool("w", false, "write the result to the file instead of printing it")
+	path, code := parseFlags(flags, args, stderr)
+	if code != exitOK {
+		return code
+	}
+
+	shebang, program, code := parseFile(path, stderr, lexer.WithComments())
+	if program == nil {
+		return code
+	}
+
+	formatted := format.Program(program)
+	// the lexer skips a #! line, so it has to be put back
+	if shebang != "" {
+		formatted = shebang + "\n" + formatted
+	}
+	if !*write {
+		fmt.Fprint(stdout, formatted)
+		return exitOK
+	}
+
+	if err := os.WriteFile(path, []byte(formatted), 0o644); err != nil {
+		fmt.Fprintf(stderr, "fmt: %s\n", err)
+		return exitError
+	}
+	return exitOK
+}
+
+func newFlagSet(name, arguments string, stderr io.Writer) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "usage: waiig %s [flags] %s\n", name, arguments)
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+// parseFlags parses the flags of a command that takes a single file
+func parseFlags(flags *flag.FlagSet, args []string, stderr io.Writer) (string, int) {
+	if err := flags.Parse(args); err != nil {
+		return "", exitUsage
+	}
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return "", exitUsage
+	}
+
+	return flags.Arg(0), exitOK
+}
+
+// parseFile parses a file while the lexer reads it, so the source isn't held in
+// memory all at once. It returns the file's #! line, if there is one, because
+// the lexer skips it. On failure the problem has already been reported and the
+// program is nil
+func parseFile(path string, stderr io.Writer, opts ...lexer.Option) (string, *ast.Program, int) {
+	file, err := os.Open(path)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return "", nil, exitError
+	}
+	defer file.Close()
+
+	input := bufio.NewReader(file)
+	shebang := ""
+	if start, _ := input.Peek(2); string(start) == "#!" {
+		shebang, _ = input.ReadString('\n')
+	}
+
+	// the lexer still gets the #! line so the positions are those in the file
+	p := parser.New(lexer.NewReader(io.MultiReader(strings.NewReader(shebang), input), opts...))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		// the diagnostics quote the lines with errors, reading the file again
+		// is cheaper than keeping it around for every file that parses. If
+		// that fails they're shown without the lines
+		source, readErr := os.ReadFile(path)
+		for i, err := range p.Errors() {
+			if i > 0 {
+				fmt.Fprintln(stderr)
+			}
+			if readErr != nil {
+				fmt.Fprintf(stderr, "%s:%s\n", path, err)
+				continue
+			}
+			fmt.Fprintf(stderr, "%s:%s\n", path, parser.Diagnostic(string(source), err))
+		}
+		return "", nil, exitError
+	}
+
+	return strings.TrimSuffix(shebang, "\n"), program, exitOK
+}
@@ -0,0 +1,581 @@
+package compiler
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"waiig/ast"
+	"waiig/code"
+	"waiig/object"
+	"waiig/token"
+)
+
+// Error is a problem found while compiling, like a name that isn't defined
+type Error struct {
+	Pos     token.Position
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Pos, e.Message)
+}
+
+func newError(node ast.Node, format string, a ...interface{}) *Error {
+	return &Error{Pos: node.Pos(), Message: fmt.Sprintf(format, a...)}
+}
+
+type EmittedInstruction struct {
+	Opcode   code.Opcode
+	Position int
+}
+
+// CompilationScope holds the instructions of the function being compiled
+type CompilationScope struct {
+	instructions        code.Instructions
+	positions           map[int]token.Position
+	lastInstruction     EmittedInstruction
+	previousInstruction EmittedInstruction
+}
+
+type Compiler struct {
+	constants []object.Object
+
+	symbolTable *SymbolTable
+
+	scopes     []CompilationScope
+	scopeIndex int
+
+	// pos is the position of the node being compiled, emit records it for the
+	// instructions of the node
+	pos token.Position
+
+	// err is the first operand that didn't fit in its instruction, the program
+	// can't be compiled then and Compile returns it
+	err *Error
+}
+
+// Bytecode is what the compiler hands over to the VM
+type Bytecode struct {
+	Instructions code.Instructions
+	Positions    map[int]token.Position // see object.CompiledFunction
+	Constants    []object.Object
+}
+
+// String disassembles the instructions and lists the constant pool, with the
+// instructions of compiled functions indented below them
+func (b *Bytecode) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(b.Instructions.String())
+
+	if len(b.Constants) > 0 {
+		out.WriteString("constants:\n")
+	}
+	for i, constant := range b.Constants {
+		fn, ok := constant.(*object.CompiledFunction)
+		if !ok {
+			fmt.Fprintf(&out, "%d: %s %s\n", i, constant.Type(), constant.Inspect())
+			continue
+		}
+
+		name := fn.Name
+		if name == "" {
+			name = "<anonymous>"
+		}
+		fmt.Fprintf(&out, "%d: %s %s (params=%d, locals=%d)\n", i, fn.Type(), name, fn.NumParameters, fn.NumLocals)
+		for _, line := range strings.SplitAfter(fn.Instructions.String(), "\n") {
+			if line != "" {
+				out.WriteString("  " + line)
+			}
+		}
+	}
+
+	return out.String()
+}
+
+func New() *Compiler {
+	mainScope := CompilationScope{
+		instructions:        code.Instructions{},
+		positions:           map[int]token.Position{},
+		lastInstruction:     EmittedInstruction{},
+		previousInstruction: EmittedInstruction{},
+	}
+
+	symbolTable := NewSymbolTable()
+	for i, b := range object.Builtins() {
+		symbolTable.DefineBuiltin(i, b.Name)
+	}
+
+	return &Compiler{
+		constants:   []object.Object{},
+		symbolTable: symbolTable,
+		scopes:      []CompilationScope{mainScope},
+		scopeIndex:  0,
+	}
+}
+
+// NewWithState creates a compiler that keeps adding to the given symbol table
+// and constants, so globals defined in one compilation are visible in the next
+func NewWithState(s *SymbolTable, constants []object.Object) *Compiler {
+	compiler := New()
+	compiler.symbolTable = s
+	compiler.constants = constants
+	return compiler
+}
+
+// NewSymbolTableWithBuiltins returns a global symbol table for NewWithState
+func NewSymbolTableWithBuiltins() *SymbolTable {
+	return New().symbolTable
+}
+
+func (c *Compiler) Compile(node ast.Node) (err error) {
+	outer := c.pos
+	c.pos = node.Pos()
+	defer func() {
+		c.pos = outer
+		if err == nil && c.err != nil {
+			err = c.err
+		}
+	}()
+
+	switch node := node.(type) {
+	case *ast.Program:
+		for _, s := range node.Statements {
+			if err := c.Compile(s); err != nil {
+				return err
+			}
+		}
+
+	case *ast.ExpressionStatement:
+		if err := c.Compile(node.Expression); err != nil {
+			return err
+		}
+		c.emit(code.OpPop)
+
+	case *ast.BlockStatement:
+		for _, s := range node.Statements {
+			if err := c.Compile(s); err != nil {
+				return err
+			}
+		}
+
+	case *ast.LetStatement:
+		// a function is defined before its body is compiled so that it can call
+		// itself, anything else can't refer to the name it's being bound to
+		var symbol Symbol
+		if _, ok := node.Value.(*ast.FunctionLiteral); ok {
+			symbol = c.symbolTable.Define(node.Name.Value)
+		}
+		if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+		if symbol.Name == "" {
+			symbol = c.symbolTable.Define(node.Name.Value)
+		}
+		if symbol.Scope == GlobalScope {
+			c.emit(code.OpSetGlobal, symbol.Index)
+		} else {
+			c.emit(code.OpSetLocal, symbol.Index)
+		}
+
+	case *ast.ReturnStatement:
+		if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+		c.emit(code.OpReturnValue)
+
+	case *ast.Identifier:
+		symbol, ok := c.symbolTable.Resolve(node.Value)
+		if !ok {
+			return newError(node, "identifier not found: %s", node.Value)
+		}
+		c.loadSymbol(symbol)
+
+	case *ast.PrefixExpression:
+		if err := c.Compile(node.Right); err != nil {
+			return err
+		}
+
+		switch node.Operator {
+		case "!":
+			c.emit(code.OpBang)
+		case "-":
+			c.emit(code.OpMinus)
+		default:
+			return newError(node, "unknown operator %s", node.Operator)
+		}
+
+	case *ast.InfixExpression:
+		if node.Operator == "&&" || node.Operator == "||" {
+			return c.compileLogical(node)
+		}
+
+		if err := c.Compile(node.Left); err != nil {
+			return err
+		}
+		if err := c.Compile(node.Right); err != nil {
+			return err
+		}
+
+		switch node.Operator {
+		case "+":
+			c.emit(code.OpAdd)
+		case "-":
+			c.emit(code.OpSub)
+		case "*":
+			c.emit(code.OpMul)
+		case "/":
+			c.emit(code.OpDiv)
+		case "%":
+			c.emit(code.OpMod)
+		case "&":
+			c.emit(code.OpBitAnd)
+		case "|":
+			c.emit(code.OpBitOr)
+		case "^":
+			c.emit(code.OpBitXor)
+		case "<<":
+			c.emit(code.OpShiftLeft)
+		case ">>":
+			c.emit(code.OpShiftRight)
+		case ">":
+			c.emit(code.OpGreaterThan)
+		case ">=":
+			c.emit(code.OpGreaterThanOrEqual)
+		case "<":
+			c.emit(code.OpLessThan)
+		case "<=":
+			c.emit(code.OpLessThanOrEqual)
+		case "==":
+			c.emit(code.OpEqual)
+		case "!=":
+			c.emit(code.OpNotEqual)
+		default:
+			return newError(node, "unknown operator %s", node.Operator)
+		}
+
+	case *ast.IfExpression:
+		if err := c.Compile(node.Condition); err != nil {
+			return err
+		}
+
+		// the jump targets are patched once the blocks are compiled
+		jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+		if err := c.compileBlockValue(node.Consequence); err != nil {
+			return err
+		}
+
+		jumpPos := c.emit(code.OpJump, 9999)
+
+		afterConsequencePos := len(c.currentInstructions())
+		c.changeOperand(jumpNotTruthyPos, afterConsequencePos)
+
+		if node.Alternative == nil {
+			c.emit(code.OpNull)
+		} else {
+			if err := c.compileBlockValue(node.Alternative); err != nil {
+				return err
+			}
+		}
+
+		afterAlternativePos := len(c.currentInstructions())
+		c.changeOperand(jumpPos, afterAlternativePos)
+
+	case *ast.IntegerLiteral:
+		integer := &object.Integer{Value: node.Value}
+		c.emit(code.OpConstant, c.addConstant(integer))
+
+	case *ast.FloatLiteral:
+		float := &object.Float{Value: node.Value}
+		c.emit(code.OpConstant, c.addConstant(float))
+
+	case *ast.StringLiteral:
+		str := &object.String{Value: node.Value}
+		c.emit(code.OpConstant, c.addConstant(str))
+
+	case *ast.Boolean:
+		if node.Value {
+			c.emit(code.OpTrue)
+		} else {
+			c.emit(code.OpFalse)
+		}
+
+	case *ast.ArrayLiteral:
+		for _, el := range node.Elements {
+			if err := c.Compile(el); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpArray, len(node.Elements))
+
+	case *ast.HashLiteral:
+		for i, key := range node.Keys {
+			if err := c.Compile(key); err != nil {
+				return err
+			}
+			if err := c.Compile(node.Values[i]); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpHash, len(node.Keys)*2)
+
+	case *ast.IndexExpression:
+		if err := c.Compile(node.Left); err != nil {
+			return err
+		}
+		if err := c.Compile(node.Index); err != nil {
+			return err
+		}
+		c.emit(code.OpIndex)
+
+	case *ast.FunctionLiteral:
+		c.enterScope()
+
+		if node.Name != "" {
+			c.symbolTable.DefineFunctionName(node.Name)
+		}
+
+		for _, p := range node.Parameters {
+			c.symbolTable.Define(p.Value)
+		}
+
+		if err := c.Compile(node.Body); err != nil {
+			return err
+		}
+
+		if c.lastInstructionIs(code.OpPop) {
+			c.replaceLastPopWithReturn()
+		}
+		if !c.lastInstructionIs(code.OpReturnValue) {
+			c.emit(code.OpReturn)
+		}
+
+		freeSymbols := c.symbolTable.FreeSymbols
+		numLocals := c.symbolTable.numDefinitions
+		positions := c.scopes[c.scopeIndex].positions
+		instructions := c.leaveScope()
+
+		for _, s := range freeSymbols {
+			c.loadSymbol(s)
+		}
+
+		compiledFn := &object.CompiledFunction{
+			Instructions:  instructions,
+			NumLocals:     numLocals,
+			NumParameters: len(node.Parameters),
+			Name:          node.Name,
+			Positions:     positions,
+		}
+		c.emit(code.OpClosure, c.addConstant(compiledFn), len(freeSymbols))
+
+	case *ast.CallExpression:
+		if err := c.Compile(node.Function); err != nil {
+			return err
+		}
+
+		for _, a := range node.Arguments {
+			if err := c.Compile(a); err != nil {
+				return err
+			}
+		}
+
+		c.emit(code.OpCall, len(node.Arguments))
+
+	default:
+		return newError(node, "can't compile %T", node)
+	}
+
+	return nil
+}
+
+func (c *Compiler) Bytecode() *Bytecode {
+	return &Bytecode{
+		Instructions: c.currentInstructions(),
+		Positions:    c.scopes[c.scopeIndex].positions,
+		Constants:    c.constants,
+	}
+}
+
+// compileLogical compiles && and || so the right operand only runs when the
+// left one doesn't decide the result. The operand that does is turned into a
+// boolean with two OpBang
+func (c *Compiler) compileLogical(node *ast.InfixExpression) error {
+	if err := c.Compile(node.Left); err != nil {
+		return err
+	}
+
+	jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+	var jumpPos int
+	if node.Operator == "&&" {
+		if err := c.compileBoolean(node.Right); err != nil {
+			return err
+		}
+		jumpPos = c.emit(code.OpJump, 9999)
+		c.changeOperand(jumpNotTruthyPos, len(c.currentInstructions()))
+		c.emit(code.OpFalse)
+	} else {
+		c.emit(code.OpTrue)
+		jumpPos = c.emit(code.OpJump, 9999)
+		c.changeOperand(jumpNotTruthyPos, len(c.currentInstructions()))
+		if err := c.compileBoolean(node.Right); err != nil {
+			return err
+		}
+	}
+
+	c.changeOperand(jumpPos, len(c.currentInstructions()))
+	return nil
+}
+
+func (c *Compiler) compileBoolean(node ast.Expression) error {
+	if err := c.Compile(node); err != nil {
+		return err
+	}
+	c.emit(code.OpBang)
+	c.emit(code.OpBang)
+	return nil
+}
+
+// compileBlockValue compiles a block whose value is used, like the branches of
+// an if. A block that doesn't end in an expression evaluates to null
+func (c *Compiler) compileBlockValue(block *ast.BlockStatement) error {
+	if err := c.Compile(block); err != nil {
+		return err
+	}
+
+	if c.lastInstructionIs(code.OpPop) {
+		c.removeLastPop()
+	} else if !c.lastInstructionIs(code.OpReturnValue) {
+		c.emit(code.OpNull)
+	}
+
+	return nil
+}
+
+func (c *Compiler) loadSymbol(s Symbol) {
+	switch s.Scope {
+	case GlobalScope:
+		c.emit(code.OpGetGlobal, s.Index)
+	case LocalScope:
+		c.emit(code.OpGetLocal, s.Index)
+	case BuiltinScope:
+		c.emit(code.OpGetBuiltin, s.Index)
+	case FreeScope:
+		c.emit(code.OpGetFree, s.Index)
+	case FunctionScope:
+		c.emit(code.OpCurrentClosure)
+	}
+}
+
+func (c *Compiler) addConstant(obj object.Object) int {
+	c.constants = append(c.constants, obj)
+	return len(c.constants) - 1
+}
+
+// emit adds the instruction to the current scope and returns its position
+func (c *Compiler) emit(op code.Opcode, operands ...int) int {
+	c.checkOperands(op, operands...)
+	ins := code.Make(op, operands...)
+	pos := c.addInstruction(ins)
+
+	c.setLastInstruction(op, pos)
+	if c.pos.IsValid() {
+		c.scopes[c.scopeIndex].positions[pos] = c.pos
+	}
+
+	return pos
+}
+
+// checkOperands keeps the first operand that's too wide, like the index of a
+// constant when there are more than 65536 of them
+func (c *Compiler) checkOperands(op code.Opcode, operands ...int) {
+	if c.err != nil {
+		return
+	}
+	if err := code.CheckOperands(op, operands...); err != nil {
+		c.err = &Error{Pos: c.pos, Message: fmt.Sprintf("program too large to compile: %s", err)}
+	}
+}
+
+func (c *Compiler) addInstruction(ins []byte) int {
+	posNewInstruction := len(c.currentInstructions())
+	c.scopes[c.scopeIndex].instructions = append(c.currentInstructions(), ins...)
+	return posNewInstruction
+}
+
+func (c *Compiler) setLastInstruction(op code.Opcode, pos int) {
+	previous := c.scopes[c.scopeIndex].lastInstruction
+	last := EmittedInstruction{Opcode: op, Position: pos}
+
+	c.scopes[c.scopeIndex].previousInstruction = previous
+	c.scopes[c.scopeIndex].lastInstruction = last
+}
+
+func (c *Compiler) currentInstructions() code.Instructions {
+	return c.scopes[c.scopeIndex].instructions
+}
+
+func (c *Compiler) lastInstructionIs(op code.Opcode) bool {
+	if len(c.currentInstructions()) == 0 {
+		return false
+	}
+
+	return c.scopes[c.scopeIndex].lastInstruction.Opcode == op
+}
+
+func (c *Compiler) removeLastPop() {
+	last := c.scopes[c.scopeIndex].lastInstruction
+	previous := c.scopes[c.scopeIndex].previousInstruction
+
+	c.scopes[c.scopeIndex].instructions = c.currentInstructions()[:last.Position]
+	c.scopes[c.scopeIndex].lastInstruction = previous
+}
+
+func (c *Compiler) replaceLastPopWithReturn() {
+	lastPos := c.scopes[c.scopeIndex].lastInstruction.Position
+	c.replaceInstruction(lastPos, code.Make(code.OpReturnValue))
+
+	c.scopes[c.scopeIndex].lastInstruction.Opcode = code.OpReturnValue
+}
+
+func (c *Compiler) replaceInstruction(pos int, newInstruction []byte) {
+	ins := c.currentInstructions()
+
+	for i := 0; i < len(newInstruction); i++ {
+		ins[pos+i] = newInstruction[i]
+	}
+}
+
+// changeOperand only works for instructions with a single operand
+func (c *Compiler) changeOperand(opPos int, operand int) {
+	op := code.Opcode(c.currentInstructions()[opPos])
+	c.checkOperands(op, operand)
+	newInstruction := code.Make(op, operand)
+
+	c.replaceInstruction(opPos, newInstruction)
+}
+
+func (c *Compiler) enterScope() {
+	scope := CompilationScope{
+		instructions:        code.Instructions{},
+		positions:           map[int]token.Position{},
+		lastInstruction:     EmittedInstruction{},
+		previousInstruction: EmittedInstruction{},
+	}
+	c.scopes = append(c.scopes, scope)
+	c.scopeIndex++
+
+	c.symbolTable = NewEnclosedSymbolTable(c.symbolTable)
+}
+
+func (c *Compiler) leaveScope() code.Instructions {
+	instructions := c.currentInstructions()
+
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	c.scopeIndex--
+
+	c.symbolTable = c.symbolTable.Outer
+
+	return instructions
+}
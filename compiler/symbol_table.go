@@ -0,0 +1,123 @@
+package compiler
+
+import "sort"
+
+type SymbolScope string
+
+const (
+	GlobalScope   SymbolScope = "GLOBAL"
+	LocalScope    SymbolScope = "LOCAL"
+	BuiltinScope  SymbolScope = "BUILTIN"
+	FreeScope     SymbolScope = "FREE"
+	FunctionScope SymbolScope = "FUNCTION"
+)
+
+type Symbol struct {
+	Name  string
+	Scope SymbolScope
+	Index int
+}
+
+type SymbolTable struct {
+	Outer *SymbolTable
+
+	store          map[string]Symbol
+	numDefinitions int
+
+	// FreeSymbols are the symbols of the outer scopes this scope refers to,
+	// in the order the closure has to capture them
+	FreeSymbols []Symbol
+}
+
+func NewSymbolTable() *SymbolTable {
+	return &SymbolTable{store: make(map[string]Symbol)}
+}
+
+func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := NewSymbolTable()
+	s.Outer = outer
+	return s
+}
+
+// Copy returns a table with the same symbols, defining names in one of them
+// doesn't change the other. The outer tables are shared
+func (s *SymbolTable) Copy() *SymbolTable {
+	c := &SymbolTable{
+		Outer:          s.Outer,
+		store:          make(map[string]Symbol, len(s.store)),
+		numDefinitions: s.numDefinitions,
+		FreeSymbols:    append([]Symbol(nil), s.FreeSymbols...),
+	}
+	for name, symbol := range s.store {
+		c.store[name] = symbol
+	}
+	return c
+}
+
+// Define binds name in this scope. Defining a name again reuses its slot, the
+// same way a second let replaces the binding in the evaluator's environment
+func (s *SymbolTable) Define(name string) Symbol {
+	scope := GlobalScope
+	if s.Outer != nil {
+		scope = LocalScope
+	}
+
+	if existing, ok := s.store[name]; ok && existing.Scope == scope {
+		return existing
+	}
+
+	symbol := Symbol{Name: name, Index: s.numDefinitions, Scope: scope}
+	s.store[name] = symbol
+	s.numDefinitions++
+	return symbol
+}
+
+func (s *SymbolTable) DefineBuiltin(index int, name string) Symbol {
+	symbol := Symbol{Name: name, Index: index, Scope: BuiltinScope}
+	s.store[name] = symbol
+	return symbol
+}
+
+// DefineFunctionName lets a function refer to itself, which is what makes
+// recursive closures work
+func (s *SymbolTable) DefineFunctionName(name string) Symbol {
+	symbol := Symbol{Name: name, Index: 0, Scope: FunctionScope}
+	s.store[name] = symbol
+	return symbol
+}
+
+func (s *SymbolTable) defineFree(original Symbol) Symbol {
+	s.FreeSymbols = append(s.FreeSymbols, original)
+
+	symbol := Symbol{Name: original.Name, Index: len(s.FreeSymbols) - 1, Scope: FreeScope}
+	s.store[original.Name] = symbol
+	return symbol
+}
+
+func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
+	obj, ok := s.store[name]
+	if ok || s.Outer == nil {
+		return obj, ok
+	}
+
+	obj, ok = s.Outer.Resolve(name)
+	if !ok {
+		return obj, ok
+	}
+
+	if obj.Scope == GlobalScope || obj.Scope == BuiltinScope {
+		return obj, ok
+	}
+
+	return s.defineFree(obj), true
+}
+
+// Symbols returns the symbols defined in this scope ordered by name
+func (s *SymbolTable) Symbols() []Symbol {
+	symbols := make([]Symbol, 0, len(s.store))
+	for _, symbol := range s.store {
+		symbols = append(symbols, symbol)
+	}
+	sort.Slice(symbols, func(i, j int) bool { return symbols[i].Name < symbols[j].Name })
+	return symbols
+}
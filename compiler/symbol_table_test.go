@@ -0,0 +1,110 @@
+package compiler
+
+import "testing"
+
+func TestDefineResolve(t *testing.T) {
+	global := NewSymbolTable()
+	a := global.Define("a")
+	b := global.Define("b")
+
+	local := NewEnclosedSymbolTable(global)
+	c := local.Define("c")
+
+	nested := NewEnclosedSymbolTable(local)
+	d := nested.Define("d")
+
+	expected := []struct {
+		table    *SymbolTable
+		name     string
+		expected Symbol
+	}{
+		{global, "a", Symbol{Name: "a", Scope: GlobalScope, Index: 0}},
+		{global, "b", Symbol{Name: "b", Scope: GlobalScope, Index: 1}},
+		{local, "a", Symbol{Name: "a", Scope: GlobalScope, Index: 0}},
+		{local, "c", Symbol{Name: "c", Scope: LocalScope, Index: 0}},
+		{nested, "c", Symbol{Name: "c", Scope: FreeScope, Index: 0}},
+		{nested, "d", Symbol{Name: "d", Scope: LocalScope, Index: 0}},
+	}
+
+	if a != expected[0].expected || b != expected[1].expected || c != expected[3].expected || d != expected[5].expected {
+		t.Fatalf("Define returned wrong symbols: %+v %+v %+v %+v", a, b, c, d)
+	}
+
+	for _, tt := range expected {
+		result, ok := tt.table.Resolve(tt.name)
+		if !ok {
+			t.Errorf("name %s not resolvable", tt.name)
+			continue
+		}
+		if result != tt.expected {
+			t.Errorf("expected %s to resolve to %+v, got=%+v", tt.name, tt.expected, result)
+		}
+	}
+
+	if len(nested.FreeSymbols) != 1 || nested.FreeSymbols[0] != c {
+		t.Errorf("wrong free symbols. got=%+v", nested.FreeSymbols)
+	}
+}
+
+func TestRedefineReusesSlot(t *testing.T) {
+	global := NewSymbolTable()
+	first := global.Define("a")
+	global.Define("b")
+	second := global.Define("a")
+
+	if first != second {
+		t.Errorf("redefining a name got a new slot. first=%+v, second=%+v", first, second)
+	}
+	if global.numDefinitions != 2 {
+		t.Errorf("wrong number of definitions. want=2, got=%d", global.numDefinitions)
+	}
+}
+
+func TestCopyIsIndependent(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a")
+
+	copied := global.Copy()
+	b := copied.Define("b")
+
+	if _, ok := global.Resolve("b"); ok {
+		t.Errorf("a name defined in the copy is defined in the original")
+	}
+	if b.Index != 1 {
+		t.Errorf("the copy doesn't continue the slots of the original. got=%+v", b)
+	}
+	if c := global.Define("c"); c.Index != 1 {
+		t.Errorf("defining in the copy used up a slot of the original. got=%+v", c)
+	}
+}
+
+func TestResolveBuiltinsAndFunctionName(t *testing.T) {
+	global := NewSymbolTable()
+	global.DefineBuiltin(3, "len")
+
+	local := NewEnclosedSymbolTable(global)
+	local.DefineFunctionName("self")
+
+	tests := []struct {
+		name     string
+		expected Symbol
+	}{
+		{"len", Symbol{Name: "len", Scope: BuiltinScope, Index: 3}},
+		{"self", Symbol{Name: "self", Scope: FunctionScope, Index: 0}},
+	}
+
+	for _, tt := range tests {
+		result, ok := local.Resolve(tt.name)
+		if !ok {
+			t.Errorf("name %s not resolvable", tt.name)
+			continue
+		}
+		if result != tt.expected {
+			t.Errorf("expected %s to resolve to %+v, got=%+v", tt.name, tt.expected, result)
+		}
+	}
+
+	if len(local.FreeSymbols) != 0 {
+		t.Errorf("builtins must not become free symbols. got=%+v", local.FreeSymbols)
+	}
+}
@@ -0,0 +1,626 @@
+package evaluator
+
+import (
+	"context"
+	"math"
+	"waiig/ast"
+	"waiig/object"
+	"waiig/token"
+)
+
+// There is only ever one true, one false and one null, so we reference these
+// instead of allocating new objects every time
+var (
+	NULL  = &object.Null{}
+	TRUE  = &object.Boolean{Value: true}
+	FALSE = &object.Boolean{Value: false}
+)
+
+// Eval evaluates the node in env without any limits
+func Eval(node ast.Node, env *object.Environment) object.Object {
+	e := &evaluator{ctx: context.Background()}
+	return e.eval(node, env)
+}
+
+// evaluator holds the state of one evaluation, which is what the limits are
+// checked against
+type evaluator struct {
+	ctx    context.Context
+	limits Limits
+
+	steps     int64
+	depth     int            // nodes being evaluated, the Go stack grows with it
+	frames    []object.Frame // Monkey function calls in progress, outermost first
+	allocated int64
+}
+
+// eval evaluates a single node. Errors that don't have a position yet get the
+// position of the node they came out of, so the innermost node wins
+func (e *evaluator) eval(node ast.Node, env *object.Environment) object.Object {
+	e.depth++
+
+	var result object.Object
+	if err := e.step(); err != nil {
+		result = err
+	} else {
+		result = e.evalNode(node, env)
+		if createsValue(node) {
+			if err := e.allocate(result); err != nil {
+				result = err
+			}
+		}
+	}
+
+	// the stack is taken along with the position, at the innermost node the
+	// calls that led to the error are all still in progress
+	switch err := result.(type) {
+	case *object.Error:
+		if !err.Pos.IsValid() && node != nil {
+			err.Pos = node.Pos()
+			err.Stack = e.stack()
+		}
+	case *object.LimitError:
+		if !err.Pos.IsValid() && node != nil {
+			err.Pos = node.Pos()
+			err.Stack = e.stack()
+		}
+	}
+
+	e.depth--
+	return result
+}
+
+func (e *evaluator) evalNode(node ast.Node, env *object.Environment) object.Object {
+	switch node := node.(type) {
+	// Statements
+	case *ast.Program:
+		return e.evalProgram(node, env)
+	case *ast.ExpressionStatement:
+		return e.eval(node.Expression, env)
+	case *ast.BlockStatement:
+		return e.evalBlockStatement(node, env)
+	case *ast.ReturnStatement:
+		val := e.eval(node.Value, env)
+		if isError(val) {
+			return val
+		}
+		return &object.ReturnValue{Value: val}
+	case *ast.LetStatement:
+		val := e.eval(node.Value, env)
+		if isError(val) {
+			return val
+		}
+		env.Set(node.Name.Value, val)
+
+	// Expressions
+	case *ast.IntegerLiteral:
+		return &object.Integer{Value: node.Value}
+
+	case *ast.FloatLiteral:
+		return &object.Float{Value: node.Value}
+	case *ast.Boolean:
+		return nativeBoolToBooleanObject(node.Value)
+	case *ast.StringLiteral:
+		return &object.String{Value: node.Value}
+	case *ast.PrefixExpression:
+		right := e.eval(node.Right, env)
+		if isError(right) {
+			return right
+		}
+		return evalPrefixExpression(node.Operator, right)
+	case *ast.InfixExpression:
+		if node.Operator == "&&" || node.Operator == "||" {
+			return e.evalLogicalExpression(node, env)
+		}
+		left := e.eval(node.Left, env)
+		if isError(left) {
+			return left
+		}
+		right := e.eval(node.Right, env)
+		if isError(right) {
+			return right
+		}
+		return evalInfixExpression(node.Operator, left, right)
+	case *ast.IfExpression:
+		return e.evalIfExpression(node, env)
+	case *ast.Identifier:
+		return evalIdentifier(node, env)
+	case *ast.FunctionLiteral:
+		return &object.Function{Name: node.Name, Parameters: node.Parameters, Body: node.Body, Env: env}
+	case *ast.CallExpression:
+		function := e.eval(node.Function, env)
+		if isError(function) {
+			return function
+		}
+		args := e.evalExpressions(node.Arguments, env)
+		if len(args) == 1 && isError(args[0]) {
+			return args[0]
+		}
+		return e.applyFunction(function, args, node.Pos())
+	case *ast.ArrayLiteral:
+		elements := e.evalExpressions(node.Elements, env)
+		if len(elements) == 1 && isError(elements[0]) {
+			return elements[0]
+		}
+		return &object.Array{Elements: elements}
+	case *ast.IndexExpression:
+		left := e.eval(node.Left, env)
+		if isError(left) {
+			return left
+		}
+		index := e.eval(node.Index, env)
+		if isError(index) {
+			return index
+		}
+		return evalIndexExpression(left, index)
+	case *ast.HashLiteral:
+		return e.evalHashLiteral(node, env)
+	}
+
+	return nil
+}
+
+func (e *evaluator) evalProgram(program *ast.Program, env *object.Environment) object.Object {
+	var result object.Object
+
+	for _, statement := range program.Statements {
+		result = e.eval(statement, env)
+
+		switch result := result.(type) {
+		case *object.ReturnValue:
+			return result.Value
+		case *object.Error, *object.LimitError:
+			return result
+		}
+	}
+
+	return result
+}
+
+// evalBlockStatement doesn't unwrap return values, so that a return inside a
+// nested block stops the evaluation of the outer blocks as well. A block is
+// always an expression, so an empty one (or one ending in a let) evaluates to null
+func (e *evaluator) evalBlockStatement(block *ast.BlockStatement, env *object.Environment) object.Object {
+	var result object.Object = NULL
+
+	for _, statement := range block.Statements {
+		result = e.eval(statement, env)
+
+		if result == nil {
+			result = NULL
+			continue
+		}
+
+		rt := result.Type()
+		if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ || rt == object.LIMIT_ERROR_OBJ {
+			return result
+		}
+	}
+
+	return result
+}
+
+func evalPrefixExpression(operator string, right object.Object) object.Object {
+	switch operator {
+	case "!":
+		return evalBangOperatorExpression(right)
+	case "-":
+		return evalMinusPrefixOperatorExpression(right)
+	default:
+		return newError("unknown operator: %s%s", operator, right.Type())
+	}
+}
+
+func evalBangOperatorExpression(right object.Object) object.Object {
+	switch right {
+	case TRUE:
+		return FALSE
+	case FALSE:
+		return TRUE
+	case NULL:
+		return TRUE
+	default:
+		return FALSE
+	}
+}
+
+func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
+	switch right := right.(type) {
+	case *object.Integer:
+		return &object.Integer{Value: -right.Value}
+	case *object.Float:
+		return &object.Float{Value: -right.Value}
+	default:
+		return newError("unknown operator: -%s", right.Type())
+	}
+}
+
+// evalLogicalExpression evaluates && and ||, the right operand is only
+// evaluated when the left one doesn't decide the result. Both give a boolean
+func (e *evaluator) evalLogicalExpression(node *ast.InfixExpression, env *object.Environment) object.Object {
+	left := e.eval(node.Left, env)
+	if isError(left) {
+		return left
+	}
+	if isTruthy(left) == (node.Operator == "||") {
+		return nativeBoolToBooleanObject(isTruthy(left))
+	}
+
+	right := e.eval(node.Right, env)
+	if isError(right) {
+		return right
+	}
+	return nativeBoolToBooleanObject(isTruthy(right))
+}
+
+func evalInfixExpression(operator string, left, right object.Object) object.Object {
+	switch {
+	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
+		return evalIntegerInfixExpression(operator, left, right)
+	case isNumber(left) && isNumber(right):
+		return evalFloatInfixExpression(operator, left, right)
+	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
+		return evalStringInfixExpression(operator, left, right)
+	// Booleans and null are singletons, so pointer comparison is enough here
+	case operator == "==":
+		return nativeBoolToBooleanObject(left == right)
+	case operator == "!=":
+		return nativeBoolToBooleanObject(left != right)
+	case left.Type() != right.Type():
+		return newError("type mismatch: %s %s %s", left.Type(), operator, right.Type())
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+func evalIntegerInfixExpression(operator string, left, right object.Object) object.Object {
+	leftVal := left.(*object.Integer).Value
+	rightVal := right.(*object.Integer).Value
+
+	switch operator {
+	case "+":
+		return &object.Integer{Value: leftVal + rightVal}
+	case "-":
+		return &object.Integer{Value: leftVal - rightVal}
+	case "*":
+		return &object.Integer{Value: leftVal * rightVal}
+	case "/":
+		if rightVal == 0 {
+			return newError("division by zero: %d / %d", leftVal, rightVal)
+		}
+		return &object.Integer{Value: leftVal / rightVal}
+	case "%":
+		if rightVal == 0 {
+			return newError("division by zero: %d %% %d", leftVal, rightVal)
+		}
+		return &object.Integer{Value: leftVal % rightVal}
+	case "&":
+		return &object.Integer{Value: leftVal & rightVal}
+	case "|":
+		return &object.Integer{Value: leftVal | rightVal}
+	case "^":
+		return &object.Integer{Value: leftVal ^ rightVal}
+	case "<<", ">>":
+		if rightVal < 0 {
+			return newError("negative shift count: %d %s %d", leftVal, operator, rightVal)
+		}
+		if operator == "<<" {
+			return &object.Integer{Value: leftVal << rightVal}
+		}
+		return &object.Integer{Value: leftVal >> rightVal}
+	case "<":
+		return nativeBoolToBooleanObject(leftVal < rightVal)
+	case ">":
+		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "<=":
+		return nativeBoolToBooleanObject(leftVal <= rightVal)
+	case ">=":
+		return nativeBoolToBooleanObject(leftVal >= rightVal)
+	case "==":
+		return nativeBoolToBooleanObject(leftVal == rightVal)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal != rightVal)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+// evalFloatInfixExpression handles two floats, or a float and an integer which
+// is converted to a float first
+func evalFloatInfixExpression(operator string, left, right object.Object) object.Object {
+	leftVal := floatValue(left)
+	rightVal := floatValue(right)
+
+	switch operator {
+	case "+":
+		return &object.Float{Value: leftVal + rightVal}
+	case "-":
+		return &object.Float{Value: leftVal - rightVal}
+	case "*":
+		return &object.Float{Value: leftVal * rightVal}
+	case "/":
+		if rightVal == 0 {
+			return newError("division by zero: %s / %s", left.Inspect(), right.Inspect())
+		}
+		return &object.Float{Value: leftVal / rightVal}
+	case "%":
+		if rightVal == 0 {
+			return newError("division by zero: %s %% %s", left.Inspect(), right.Inspect())
+		}
+		return &object.Float{Value: math.Mod(leftVal, rightVal)}
+	case "<":
+		return nativeBoolToBooleanObject(leftVal < rightVal)
+	case ">":
+		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "<=":
+		return nativeBoolToBooleanObject(leftVal <= rightVal)
+	case ">=":
+		return nativeBoolToBooleanObject(leftVal >= rightVal)
+	case "==":
+		return nativeBoolToBooleanObject(leftVal == rightVal)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal != rightVal)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+func isNumber(obj object.Object) bool {
+	return obj.Type() == object.INTEGER_OBJ || obj.Type() == object.FLOAT_OBJ
+}
+
+func floatValue(obj object.Object) float64 {
+	if i, ok := obj.(*object.Integer); ok {
+		return float64(i.Value)
+	}
+	return obj.(*object.Float).Value
+}
+
+func evalStringInfixExpression(operator string, left, right object.Object) object.Object {
+	leftVal := left.(*object.String).Value
+	rightVal := right.(*object.String).Value
+
+	switch operator {
+	case "+":
+		return &object.String{Value: leftVal + rightVal}
+	case "==":
+		return nativeBoolToBooleanObject(leftVal == rightVal)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal != rightVal)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+func (e *evaluator) evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
+	condition := e.eval(ie.Condition, env)
+	if isError(condition) {
+		return condition
+	}
+
+	if isTruthy(condition) {
+		return e.eval(ie.Consequence, env)
+	} else if ie.Alternative != nil {
+		return e.eval(ie.Alternative, env)
+	} else {
+		return NULL
+	}
+}
+
+// evalIdentifier falls back to the builtins when a name isn't bound in the
+// environment, so user code can shadow a builtin with its own let
+func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object {
+	if val, ok := env.Get(node.Value); ok {
+		return val
+	}
+
+	if builtin := object.GetBuiltinByName(node.Value); builtin != nil {
+		return builtin
+	}
+
+	return newError("identifier not found: %s", node.Value)
+}
+
+// evalExpressions evaluates expressions left to right and stops at the first
+// error, which is then returned as the only element
+func (e *evaluator) evalExpressions(exps []ast.Expression, env *object.Environment) []object.Object {
+	var result []object.Object
+
+	for _, exp := range exps {
+		evaluated := e.eval(exp, env)
+		if isError(evaluated) {
+			return []object.Object{evaluated}
+		}
+		result = append(result, evaluated)
+	}
+
+	return result
+}
+
+func evalIndexExpression(left, index object.Object) object.Object {
+	switch {
+	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
+		return evalArrayIndexExpression(left, index)
+	case left.Type() == object.HASH_OBJ:
+		return evalHashIndexExpression(left, index)
+	default:
+		return newError("index operator not supported: %s[%s]", left.Type(), index.Type())
+	}
+}
+
+// evalArrayIndexExpression returns null for an index that's out of range
+func evalArrayIndexExpression(array, index object.Object) object.Object {
+	elements := array.(*object.Array).Elements
+	idx := index.(*object.Integer).Value
+	max := int64(len(elements) - 1)
+
+	if idx < 0 || idx > max {
+		return NULL
+	}
+
+	return elements[idx]
+}
+
+func evalHashIndexExpression(hash, index object.Object) object.Object {
+	hashObject := hash.(*object.Hash)
+
+	key, ok := index.(object.Hashable)
+	if !ok {
+		return newError("unusable as hash key: %s", index.Type())
+	}
+
+	pair, ok := hashObject.Pairs[key.HashKey()]
+	if !ok {
+		return NULL
+	}
+
+	return pair.Value
+}
+
+func (e *evaluator) evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Object {
+	pairs := make(map[object.HashKey]object.HashPair)
+
+	for i, keyNode := range node.Keys {
+		key := e.eval(keyNode, env)
+		if isError(key) {
+			return key
+		}
+
+		hashKey, ok := key.(object.Hashable)
+		if !ok {
+			return newError("unusable as hash key: %s", key.Type())
+		}
+
+		value := e.eval(node.Values[i], env)
+		if isError(value) {
+			return value
+		}
+
+		pairs[hashKey.HashKey()] = object.HashPair{Key: key, Value: value}
+	}
+
+	return &object.Hash{Pairs: pairs}
+}
+
+// applyFunction calls fn with args, pos is where it's called from
+func (e *evaluator) applyFunction(fn object.Object, args []object.Object, pos token.Position) object.Object {
+	switch function := fn.(type) {
+	case *object.Function:
+		if len(args) != len(function.Parameters) {
+			return newError("wrong number of arguments: want=%d, got=%d", len(function.Parameters), len(args))
+		}
+
+		if err := e.pushFrame(function, pos); err != nil {
+			return err
+		}
+		defer e.popFrame()
+
+		extendedEnv := extendFunctionEnv(function, args)
+		evaluated := e.eval(function.Body, extendedEnv)
+		return unwrapReturnValue(evaluated)
+	case *object.Builtin:
+		result := function.Call(args...)
+		if result == nil {
+			return NULL
+		}
+		if err := e.allocate(result); err != nil {
+			return err
+		}
+		return result
+	default:
+		return newError("not a function: %s", fn.Type())
+	}
+}
+
+// pushFrame records a call of fn. Without a limit on the depth deep recursion
+// would overflow the Go stack and take the whole process down
+func (e *evaluator) pushFrame(fn *object.Function, pos token.Position) *object.LimitError {
+	max := e.limits.MaxCallDepth
+	if max <= 0 {
+		max = DefaultMaxCallDepth
+	}
+	if len(e.frames) >= max {
+		return limitError("maximum recursion depth exceeded: %d nested calls", max)
+	}
+
+	name := fn.Name
+	if name == "" {
+		name = "<anonymous>"
+	}
+	e.frames = append(e.frames, object.Frame{Function: name, Pos: pos})
+	return nil
+}
+
+func (e *evaluator) popFrame() {
+	e.frames = e.frames[:len(e.frames)-1]
+}
+
+// stack returns a copy of the calls in progress, innermost first
+func (e *evaluator) stack() []object.Frame {
+	if len(e.frames) == 0 {
+		return nil
+	}
+
+	stack := make([]object.Frame, len(e.frames))
+	for i, frame := range e.frames {
+		stack[len(e.frames)-1-i] = frame
+	}
+	return stack
+}
+
+// extendFunctionEnv encloses the environment the function was defined in, not
+// the one it's called from
+func extendFunctionEnv(fn *object.Function, args []object.Object) *object.Environment {
+	env := object.NewEnclosedEnvironment(fn.Env)
+
+	for i, param := range fn.Parameters {
+		env.Set(param.Value, args[i])
+	}
+
+	return env
+}
+
+// unwrapReturnValue stops a return inside the function body from bubbling up
+// and stopping the evaluation of the caller
+func unwrapReturnValue(obj object.Object) object.Object {
+	if returnValue, ok := obj.(*object.ReturnValue); ok {
+		return returnValue.Value
+	}
+
+	return obj
+}
+
+// helpers
+
+func isTruthy(obj object.Object) bool {
+	switch obj {
+	case NULL:
+		return false
+	case TRUE:
+		return true
+	case FALSE:
+		return false
+	default:
+		return true
+	}
+}
+
+func nativeBoolToBooleanObject(input bool) *object.Boolean {
+	if input {
+		return TRUE
+	}
+	return FALSE
+}
+
+func newError(format string, a ...interface{}) *object.Error {
+	return object.NewError(format, a...)
+}
+
+// isError is true for limit errors as well, they have to stop the evaluation
+// just the same
+func isError(obj object.Object) bool {
+	if obj != nil {
+		return obj.Type() == object.ERROR_OBJ || obj.Type() == object.LIMIT_ERROR_OBJ
+	}
+	return false
+}
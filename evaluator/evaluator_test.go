@@ -0,0 +1,832 @@
+package evaluator
+
+import (
+	"strconv"
+	"testing"
+	"waiig/lexer"
+	"waiig/object"
+	"waiig/parser"
+)
+
+func TestEvalIntegerExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"5", 5},
+		{"10", 10},
+		{"-5", -5},
+		{"-10", -10},
+		{"5 + 5 + 5 + 5 - 10", 10},
+		{"2 * 2 * 2 * 2 * 2", 32},
+		{"-50 + 100 + -50", 0},
+		{"5 * 2 + 10", 20},
+		{"5 + 2 * 10", 25},
+		{"20 + 2 * -10", 0},
+		{"50 / 2 * 2 + 10", 60},
+		{"2 * (5 + 10)", 30},
+		{"3 * 3 * 3 + 10", 37},
+		{"3 * (3 * 3) + 10", 37},
+		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		testIntegerObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestEvalNumberLiterals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"0xff", 255},
+		{"0o17 + 0b11", 18},
+		{"1_000_000 / 1_000", 1000},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		testIntegerObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestEvalFloatExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"1.5", 1.5},
+		{"-2.5", -2.5},
+		{"1.5 + 1.5", 3.0},
+		{"1 + 0.5", 1.5},
+		{"0.5 * 4", 2.0},
+		{"7 / 2.0", 3.5},
+		{"7 / 2", 3},
+		{"1e3 - 1", 999.0},
+		{"1 < 1.5", true},
+		{"2.5 > 2", true},
+		{"1 == 1.0", true},
+		{"0.1 + 0.2 != 0.3", true},
+		{"1.0 / 0", "division by zero: 1.0 / 0"},
+		{"1.5 + true", "type mismatch: FLOAT + BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+
+		switch expected := tt.expected.(type) {
+		case float64:
+			float, ok := evaluated.(*object.Float)
+			if !ok {
+				t.Errorf("%q: object is not Float. got=%T (%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if float.Value != expected {
+				t.Errorf("%q: wrong value. want=%g, got=%g", tt.input, expected, float.Value)
+			}
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			err, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("%q: no error object returned. got=%T (%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if err.Message != expected {
+				t.Errorf("%q: wrong error message. want=%q, got=%q", tt.input, expected, err.Message)
+			}
+		}
+	}
+}
+
+func TestEvalIntegerOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"7 % 3", 1},
+		{"-7 % 3", -1},
+		{"6 & 3", 2},
+		{"6 | 3", 7},
+		{"6 ^ 3", 5},
+		{"1 << 4", 16},
+		{"-16 >> 2", -4},
+		{"1 << 2 + 1", 8},
+		{"5.5 % 2", 1.5},
+		{"1 <= 1", true},
+		{"2 <= 1", false},
+		{"1 >= 1.5", false},
+		{"2.5 >= 2", true},
+		{"5 % 0", "division by zero: 5 % 0"},
+		{"1 << -1", "negative shift count: 1 << -1"},
+		{"1.5 & 1", "unknown operator: FLOAT & INTEGER"},
+		{`"a" <= "b"`, "unknown operator: STRING <= STRING"},
+		{"true | false", "unknown operator: BOOLEAN | BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case float64:
+			float, ok := evaluated.(*object.Float)
+			if !ok || float.Value != expected {
+				t.Errorf("%q: object is not Float %g. got=%T (%+v)", tt.input, expected, evaluated, evaluated)
+			}
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			err, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("%q: no error object returned. got=%T (%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if err.Message != expected {
+				t.Errorf("%q: wrong error message. want=%q, got=%q", tt.input, expected, err.Message)
+			}
+		}
+	}
+}
+
+func TestEvalLogicalOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"true && true", true},
+		{"true && false", false},
+		{"false || true", true},
+		{"false || false", false},
+		{"1 && \"\"", true},
+		{"if (false) { 1 } || 0", true},
+		{"1 < 2 && 2 < 3", true},
+		// the right operand isn't evaluated when the left one decides
+		{"false && missing", false},
+		{"true || missing", true},
+		{"true && missing", "identifier not found: missing"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+
+		switch expected := tt.expected.(type) {
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			err, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("%q: no error object returned. got=%T (%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if err.Message != expected {
+				t.Errorf("%q: wrong error message. want=%q, got=%q", tt.input, expected, err.Message)
+			}
+		}
+	}
+}
+
+func TestEvalBooleanExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"true", true},
+		{"false", false},
+		{"1 < 2", true},
+		{"1 > 2", false},
+		{"1 < 1", false},
+		{"1 > 1", false},
+		{"1 == 1", true},
+		{"1 != 1", false},
+		{"1 == 2", false},
+		{"1 != 2", true},
+		{"true == true", true},
+		{"false == false", true},
+		{"true == false", false},
+		{"true != false", true},
+		{"false != true", true},
+		{"(1 < 2) == true", true},
+		{"(1 < 2) == false", false},
+		{"(1 > 2) == true", false},
+		{"(1 > 2) == false", true},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		testBooleanObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestBangOperator(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"!true", false},
+		{"!false", true},
+		{"!5", false},
+		{"!!true", true},
+		{"!!false", false},
+		{"!!5", true},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		testBooleanObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestIfElseExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"if (true) { 10 }", 10},
+		{"if (false) { 10 }", nil},
+		{"if (1) { 10 }", 10},
+		{"if (1 < 2) { 10 }", 10},
+		{"if (1 > 2) { 10 }", nil},
+		{"if (1 > 2) { 10 } else { 20 }", 20},
+		{"if (1 < 2) { 10 } else { 20 }", 10},
+		{"if (true) { }", nil},
+		{"if (true) { let a = 1; }", nil},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		integer, ok := tt.expected.(int)
+		if ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestReturnStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"return 10;", 10},
+		{"return 10; 9;", 10},
+		{"return 2 * 5; 9;", 10},
+		{"9; return 2 * 5; 9;", 10},
+		{`
+if (10 > 1) {
+  if (10 > 1) {
+    return 10;
+  }
+
+  return 1;
+}
+`, 10},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		testIntegerObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestLetStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let a = 5; a;", 5},
+		{"let a = 5 * 5; a;", 25},
+		{"let a = 5; let b = a; b;", 5},
+		{"let a = 5; let b = a; let c = a + b + 5; c;", 15},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(t, tt.input), tt.expected)
+	}
+}
+
+func TestErrorHandling(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"5 + true;", "type mismatch: INTEGER + BOOLEAN"},
+		{"5 + true; 5;", "type mismatch: INTEGER + BOOLEAN"},
+		{"-true", "unknown operator: -BOOLEAN"},
+		{"true + false;", "unknown operator: BOOLEAN + BOOLEAN"},
+		{"5; true + false; 5", "unknown operator: BOOLEAN + BOOLEAN"},
+		{"if (10 > 1) { true + false; }", "unknown operator: BOOLEAN + BOOLEAN"},
+		{"if (10 > 1) { if (10 > 1) { true + false; } 1 }", "unknown operator: BOOLEAN + BOOLEAN"},
+		{"if (10 > 1) { return true + false; }", "unknown operator: BOOLEAN + BOOLEAN"},
+		{"foobar", "identifier not found: foobar"},
+		{"let a = b; a", "identifier not found: b"},
+		{"10 / 0", "division by zero: 10 / 0"},
+		{"let x = 5; x(1)", "not a function: INTEGER"},
+		{"fn(x) { x }(1, 2)", "wrong number of arguments: want=1, got=2"},
+		{"fn(x) { y }(1)", "identifier not found: y"},
+		{`"Hello" - "World"`, "unknown operator: STRING - STRING"},
+		{`"Hello" + 1`, "type mismatch: STRING + INTEGER"},
+		{`{"name": "Monkey"}[fn(x) { x }];`, "unusable as hash key: FUNCTION"},
+		{`{[1]: 2}`, "unusable as hash key: ARRAY"},
+		{`1[0]`, "index operator not supported: INTEGER[INTEGER]"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+			continue
+		}
+
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q", tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func TestFunctionObject(t *testing.T) {
+	input := "fn(x) { x + 2; };"
+
+	evaluated := testEval(t, input)
+	fn, ok := evaluated.(*object.Function)
+	if !ok {
+		t.Fatalf("object is not Function. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if len(fn.Parameters) != 1 {
+		t.Fatalf("function has wrong parameters. Parameters=%+v", fn.Parameters)
+	}
+
+	if fn.Parameters[0].String() != "x" {
+		t.Fatalf("parameter is not 'x'. got=%q", fn.Parameters[0])
+	}
+
+	expectedBody := "(x + 2)"
+	if fn.Body.String() != expectedBody {
+		t.Fatalf("body is not %q. got=%q", expectedBody, fn.Body.String())
+	}
+}
+
+func TestFunctionApplication(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let identity = fn(x) { x; }; identity(5);", 5},
+		{"let identity = fn(x) { return x; }; identity(5);", 5},
+		{"let double = fn(x) { x * 2; }; double(5);", 10},
+		{"let add = fn(x, y) { x + y; }; add(5, 5);", 10},
+		{"let add = fn(x, y) { x + y; }; add(5 + 5, add(5, 5));", 20},
+		{"fn(x) { x; }(5)", 5},
+		{"let f = fn() { return 1; 2 }; f() + 10", 11},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(t, tt.input), tt.expected)
+	}
+}
+
+func TestClosures(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{`
+let adder = fn(x) { fn(y) { x + y } };
+let addTwo = adder(2);
+addTwo(3);`, 5},
+		{`
+let x = 10;
+let shadow = fn(x) { x * 2 };
+shadow(1) + x;`, 12},
+		{`
+let add = fn(a, b) { a + b };
+let applyFunc = fn(a, b, func) { func(a, b) };
+applyFunc(2, 2, add);`, 4},
+		{`
+let counter = fn(x) {
+  if (x > 100) {
+    return x;
+  } else {
+    let next = x + 1;
+    counter(next);
+  }
+};
+counter(0);`, 101},
+		{`
+let makeGetter = fn() { let hidden = 42; fn() { hidden } };
+let get = makeGetter();
+let hidden = 1;
+get();`, 42},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(t, tt.input), tt.expected)
+	}
+}
+
+func TestClosureDoesNotLeakIntoOuterEnvironment(t *testing.T) {
+	input := `
+let f = fn() { let inner = 1; inner };
+f();
+inner;`
+
+	evaluated := testEval(t, input)
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+	}
+	if errObj.Message != "identifier not found: inner" {
+		t.Errorf("wrong error message. got=%q", errObj.Message)
+	}
+}
+
+func TestStringLiteral(t *testing.T) {
+	input := `"Hello\tWorld!"`
+
+	testStringObject(t, testEval(t, input), "Hello\tWorld!")
+}
+
+func TestStringConcatenation(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`"Hello" + " " + "World!"`, "Hello World!"},
+		{`let greet = fn(name) { "Hello, " + name }; greet("Monkey")`, "Hello, Monkey"},
+		{`"\u{1F412}" + "\\"`, "\U0001F412\\"},
+	}
+
+	for _, tt := range tests {
+		testStringObject(t, testEval(t, tt.input), tt.expected)
+	}
+}
+
+func TestStringComparison(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{`"a" == "a"`, true},
+		{`"a" == "b"`, false},
+		{`"a" != "b"`, true},
+		{`"a" + "b" == "ab"`, true},
+	}
+
+	for _, tt := range tests {
+		testBooleanObject(t, testEval(t, tt.input), tt.expected)
+	}
+}
+
+func TestArrayLiterals(t *testing.T) {
+	input := "[1, 2 * 2, 3 + 3]"
+
+	evaluated := testEval(t, input)
+	result, ok := evaluated.(*object.Array)
+	if !ok {
+		t.Fatalf("object is not Array. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if len(result.Elements) != 3 {
+		t.Fatalf("array has wrong num of elements. got=%d", len(result.Elements))
+	}
+
+	testIntegerObject(t, result.Elements[0], 1)
+	testIntegerObject(t, result.Elements[1], 4)
+	testIntegerObject(t, result.Elements[2], 6)
+}
+
+func TestArrayIndexExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"[1, 2, 3][0]", 1},
+		{"[1, 2, 3][1]", 2},
+		{"[1, 2, 3][2]", 3},
+		{"let i = 0; [1][i];", 1},
+		{"[1, 2, 3][1 + 1];", 3},
+		{"let myArray = [1, 2, 3]; myArray[2];", 3},
+		{"let myArray = [1, 2, 3]; myArray[0] + myArray[1] + myArray[2];", 6},
+		{"let myArray = [1, 2, 3]; let i = myArray[0]; myArray[i]", 2},
+		{"[1, 2, 3][3]", nil},
+		{"[1, 2, 3][-1]", nil},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		integer, ok := tt.expected.(int)
+		if ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestHashLiterals(t *testing.T) {
+	input := `let two = "two";
+	{
+		"one": 10 - 9,
+		two: 1 + 1,
+		"thr" + "ee": 6 / 2,
+		4: 4,
+		true: 5,
+		false: 6
+	}`
+
+	evaluated := testEval(t, input)
+	result, ok := evaluated.(*object.Hash)
+	if !ok {
+		t.Fatalf("Eval didn't return Hash. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	expected := map[object.HashKey]int64{
+		(&object.String{Value: "one"}).HashKey():   1,
+		(&object.String{Value: "two"}).HashKey():   2,
+		(&object.String{Value: "three"}).HashKey(): 3,
+		(&object.Integer{Value: 4}).HashKey():      4,
+		TRUE.HashKey():                             5,
+		FALSE.HashKey():                            6,
+	}
+
+	if len(result.Pairs) != len(expected) {
+		t.Fatalf("Hash has wrong num of pairs. got=%d", len(result.Pairs))
+	}
+
+	for expectedKey, expectedValue := range expected {
+		pair, ok := result.Pairs[expectedKey]
+		if !ok {
+			t.Errorf("no pair for given key in Pairs")
+		}
+
+		testIntegerObject(t, pair.Value, expectedValue)
+	}
+}
+
+func TestHashIndexExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`{"foo": 5}["foo"]`, 5},
+		{`{"foo": 5}["bar"]`, nil},
+		{`let key = "foo"; {"foo": 5}[key]`, 5},
+		{`{}["foo"]`, nil},
+		{`{5: 5}[5]`, 5},
+		{`{true: 5}[true]`, 5},
+		{`{false: 5}[false]`, 5},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		integer, ok := tt.expected.(int)
+		if ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestBuiltinFunctions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`len("")`, 0},
+		{`len("four")`, 4},
+		{`len("hello world")`, 11},
+		{`len([1, 2, 3])`, 3},
+		{`len([])`, 0},
+		{`len({"a": 1})`, 1},
+		{`len(1)`, "argument 1 to `len` must be STRING or ARRAY or HASH, got INTEGER"},
+		{`len("one", "two")`, "wrong number of arguments to `len`: got=2, want=1"},
+		{`first([1, 2, 3])`, 1},
+		{`first([])`, nil},
+		{`first(1)`, "argument 1 to `first` must be ARRAY, got INTEGER"},
+		{`last([1, 2, 3])`, 3},
+		{`last([])`, nil},
+		{`last(1)`, "argument 1 to `last` must be ARRAY, got INTEGER"},
+		{`rest([1, 2, 3])`, []int{2, 3}},
+		{`rest([1])`, []int{}},
+		{`rest([])`, nil},
+		{`push([], 1)`, []int{1}},
+		{`let a = [1]; push(a, 2); a`, []int{1}},
+		{`push(1, 1)`, "argument 1 to `push` must be ARRAY, got INTEGER"},
+		{`puts()`, nil},
+		{`let len = fn(x) { 42 }; len("a")`, 42},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case nil:
+			testNullObject(t, evaluated)
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+			}
+		case []int:
+			array, ok := evaluated.(*object.Array)
+			if !ok {
+				t.Errorf("obj not Array. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+
+			if len(array.Elements) != len(expected) {
+				t.Errorf("wrong num of elements. want=%d, got=%d", len(expected), len(array.Elements))
+				continue
+			}
+
+			for i, expectedElem := range expected {
+				testIntegerObject(t, array.Elements[i], int64(expectedElem))
+			}
+		}
+	}
+}
+
+func TestRegisteredBuiltin(t *testing.T) {
+	object.RegisterBuiltin(&object.Builtin{
+		Name:  "double",
+		Arity: 1,
+		Types: [][]object.ObjectType{{object.INTEGER_OBJ}},
+		Fn: func(args ...object.Object) object.Object {
+			return &object.Integer{Value: args[0].(*object.Integer).Value * 2}
+		},
+	})
+
+	testIntegerObject(t, testEval(t, "double(21)"), 42)
+}
+
+func TestErrorPositions(t *testing.T) {
+	tests := []struct {
+		input       string
+		expectedPos string
+	}{
+		{"5 + true;", "1:3"},
+		{"let a = 1;\nlet b = a + c;", "2:13"},
+		{"let f = fn(x) {\n  -x\n};\nf(true)", "2:3"},
+		{`len(1)`, "1:4"},
+		{"if (true) {\n  [1][\"a\"]\n}", "2:6"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+			continue
+		}
+
+		if errObj.Pos.String() != tt.expectedPos {
+			t.Errorf("wrong error position for %q. expected=%s, got=%s", tt.input, tt.expectedPos, errObj.Pos)
+		}
+	}
+}
+
+// helpers
+
+func testEval(t *testing.T, input string) object.Object {
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser has errors for %q: %v", input, p.Errors())
+	}
+	env := object.NewEnvironment()
+
+	return Eval(program, env)
+}
+
+func testIntegerObject(t *testing.T, obj object.Object, expected int64) bool {
+	result, ok := obj.(*object.Integer)
+	if !ok {
+		t.Errorf("object is not Integer. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%d, want=%d", result.Value, expected)
+		return false
+	}
+	return true
+}
+
+func testBooleanObject(t *testing.T, obj object.Object, expected bool) bool {
+	result, ok := obj.(*object.Boolean)
+	if !ok {
+		t.Errorf("object is not Boolean. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%t, want=%t", result.Value, expected)
+		return false
+	}
+	return true
+}
+
+func testStringObject(t *testing.T, obj object.Object, expected string) bool {
+	result, ok := obj.(*object.String)
+	if !ok {
+		t.Errorf("object is not String. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%q, want=%q", result.Value, expected)
+		return false
+	}
+	return true
+}
+
+func testNullObject(t *testing.T, obj object.Object) bool {
+	if obj != NULL {
+		t.Errorf("object is not NULL. got=%T (%+v)", obj, obj)
+		return false
+	}
+	return true
+}
+
+func TestErrorStackTraces(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			"5 + true",
+			"ERROR: 1:3: type mismatch: INTEGER + BOOLEAN",
+		},
+		{
+			`let add = fn(a, b) { a + b };
+let twice = fn(x) { add(x, x) };
+twice(true)`,
+			"ERROR: 1:24: unknown operator: BOOLEAN + BOOLEAN\n" +
+				"\tin add called at 2:24\n" +
+				"\tin twice called at 3:6",
+		},
+		{
+			`let apply = fn(f) { f() };
+apply(fn() { len(1) })`,
+			"ERROR: 2:17: argument 1 to `len` must be STRING or ARRAY or HASH, got INTEGER\n" +
+				"\tin <anonymous> called at 1:22\n" +
+				"\tin apply called at 2:6",
+		},
+		{
+			`let f = fn(n) { if (n == 0) { missing } else { f(n - 1) } };
+f(3)`,
+			"ERROR: 1:31: identifier not found: missing\n" +
+				"\tin f called at 1:49\n" +
+				"\t[previous call repeated 2 more times]\n" +
+				"\tin f called at 2:2",
+		},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong error for %q.\nwant=%q\ngot =%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestMaximumRecursionDepth(t *testing.T) {
+	input := `
+	let countDown = fn(n) { if (n == 0) { 0 } else { countDown(n - 1) } };
+	countDown(` + strconv.Itoa(DefaultMaxCallDepth-1) + `);
+	countDown(` + strconv.Itoa(DefaultMaxCallDepth) + `);
+	`
+
+	evaluated := testEval(t, input)
+
+	err, ok := evaluated.(*object.LimitError)
+	if !ok {
+		t.Fatalf("no limit error. got=%T (%+v)", evaluated, evaluated)
+	}
+	expected := "maximum recursion depth exceeded: 10000 nested calls"
+	if err.Message != expected {
+		t.Errorf("wrong message. want=%q, got=%q", expected, err.Message)
+	}
+	if len(err.Stack) != DefaultMaxCallDepth {
+		t.Errorf("wrong stack depth. want=%d, got=%d", DefaultMaxCallDepth, len(err.Stack))
+	}
+	if err.Stack[len(err.Stack)-1].Pos.Line != 4 {
+		t.Errorf("outermost call has the wrong position. got=%s", err.Stack[len(err.Stack)-1].Pos)
+	}
+}
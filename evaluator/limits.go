@@ -0,0 +1,108 @@
+package evaluator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+	"waiig/ast"
+	"waiig/object"
+)
+
+// Limits bound the work a single evaluation may do. A zero field means there
+// is no limit of that kind, except for the call depth and the nesting which
+// always have one
+type Limits struct {
+	MaxSteps      int64         // nodes evaluated
+	Timeout       time.Duration // wall-clock time
+	MaxCallDepth  int           // Monkey function calls in progress at once, DefaultMaxCallDepth if zero
+	MaxNesting    int           // nodes being evaluated inside each other, DefaultMaxNesting if zero
+	MaxAllocBytes int64         // rough size of all the values created
+}
+
+// DefaultMaxCallDepth is deep enough for any sensible recursion and shallow
+// enough to stay far away from the Go stack limit
+const DefaultMaxCallDepth = 10000
+
+// DefaultMaxNesting bounds how deep eval recurses, through nested expressions
+// as well as calls. A call takes about six levels, so DefaultMaxCallDepth fits
+const DefaultMaxNesting = 100000
+
+// the context is checked every this many steps, looking at it on every node
+// would make evaluation noticeably slower
+const contextCheckInterval = 1024
+
+// EvalContext evaluates the node in env like Eval, but stops with an
+// *object.LimitError once ctx is done or one of the limits is exceeded
+func EvalContext(ctx context.Context, node ast.Node, env *object.Environment, limits Limits) object.Object {
+	if limits.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, limits.Timeout)
+		defer cancel()
+	}
+
+	e := &evaluator{ctx: ctx, limits: limits}
+	return e.eval(node, env)
+}
+
+// step counts a node being evaluated, e.depth has to be increased already
+func (e *evaluator) step() *object.LimitError {
+	e.steps++
+
+	max := e.limits.MaxNesting
+	if max <= 0 {
+		max = DefaultMaxNesting
+	}
+	if e.depth > max {
+		return limitError("maximum nesting depth exceeded: %d nested nodes", max)
+	}
+
+	if e.limits.MaxSteps > 0 && e.steps > e.limits.MaxSteps {
+		return limitError("step limit exceeded: %d steps", e.limits.MaxSteps)
+	}
+
+	if e.steps%contextCheckInterval == 0 {
+		switch err := e.ctx.Err(); {
+		case errors.Is(err, context.DeadlineExceeded):
+			if e.limits.Timeout > 0 {
+				return limitError("timeout exceeded: %s", e.limits.Timeout)
+			}
+			return limitError("deadline exceeded")
+		case err != nil:
+			return limitError("evaluation canceled")
+		}
+	}
+
+	return nil
+}
+
+// allocate counts a value that was just created
+func (e *evaluator) allocate(obj object.Object) *object.LimitError {
+	if e.limits.MaxAllocBytes <= 0 {
+		return nil
+	}
+
+	// the values obj holds were counted when they were created
+	e.allocated += object.Size(obj)
+	if e.allocated > e.limits.MaxAllocBytes {
+		return limitError("allocation limit exceeded: %d bytes", e.limits.MaxAllocBytes)
+	}
+	return nil
+}
+
+// createsValue tells the nodes that evaluate to a new value apart from the ones
+// that hand out values which already exist, like identifiers and calls of
+// Monkey functions. Builtins are counted when they're applied
+func createsValue(node ast.Node) bool {
+	switch node.(type) {
+	case *ast.IntegerLiteral, *ast.FloatLiteral, *ast.StringLiteral, *ast.PrefixExpression, *ast.InfixExpression,
+		*ast.ArrayLiteral, *ast.HashLiteral, *ast.FunctionLiteral:
+		return true
+	default:
+		return false
+	}
+}
+
+func limitError(format string, a ...interface{}) *object.LimitError {
+	return &object.LimitError{Message: fmt.Sprintf(format, a...)}
+}
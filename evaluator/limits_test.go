@@ -0,0 +1,102 @@
+package evaluator
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+	"waiig/ast"
+	"waiig/lexer"
+	"waiig/object"
+	"waiig/parser"
+)
+
+func TestEvalContextLimits(t *testing.T) {
+	const fib = `let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } };`
+	const double = `let double = fn(s, n) { if (n == 0) { s } else { double(s + s, n - 1) } };`
+
+	tests := []struct {
+		input    string
+		limits   Limits
+		expected string
+	}{
+		{fib + "fib(15)", Limits{MaxSteps: 1000}, "step limit exceeded: 1000 steps"},
+		{fib + "fib(30)", Limits{Timeout: 10 * time.Millisecond}, "timeout exceeded: 10ms"},
+		{"let f = fn() { f() }; f()", Limits{MaxCallDepth: 100}, "1:17: maximum recursion depth exceeded: 100 nested calls"},
+		{double + `double("ab", 30)`, Limits{MaxAllocBytes: 1 << 20}, "allocation limit exceeded: 1048576 bytes"},
+		{`let a = []; let a = push(a, 1); push(a, 2)`, Limits{MaxAllocBytes: 100}, "allocation limit exceeded: 100 bytes"},
+		{"let f = fn() { f() }; let x = [1, f()]; x", Limits{MaxCallDepth: 10}, "maximum recursion depth exceeded"},
+		{"let f = fn() { f() }; {f(): 1}", Limits{MaxCallDepth: 10}, "maximum recursion depth exceeded"},
+		{"let f = fn() { f() }; len(f())", Limits{MaxCallDepth: 10}, "maximum recursion depth exceeded"},
+		{strings.Repeat("-", 50) + "1", Limits{MaxNesting: 20}, "1:19: maximum nesting depth exceeded: 20 nested nodes"},
+		{"let f = fn(n) { " + strings.Repeat("!", 100) + "f(n) }; f(1)", Limits{MaxNesting: 1000}, "maximum nesting depth exceeded"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEvalContext(context.Background(), tt.input, tt.limits)
+
+		err, ok := evaluated.(*object.LimitError)
+		if !ok {
+			t.Errorf("no limit error for %q. got=%T (%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if !strings.Contains(err.Inspect(), tt.expected) {
+			t.Errorf("wrong limit error for %q. want=%q, got=%q", tt.input, tt.expected, err.Inspect())
+		}
+	}
+}
+
+func TestEvalContextWithinLimits(t *testing.T) {
+	limits := Limits{MaxSteps: 100_000, Timeout: time.Minute, MaxCallDepth: 100, MaxAllocBytes: 1 << 20}
+	input := `
+	let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } };
+	let h = {"a": [1, 2, 3]};
+	fib(10) + len(h["a"])
+	`
+
+	testIntegerObject(t, testEvalContext(context.Background(), input, limits), 58)
+}
+
+func TestEvalContextDeepNesting(t *testing.T) {
+	// deeper than the parser allows and deep enough to overflow the Go stack
+	// without the default limit
+	var exp ast.Expression = &ast.IntegerLiteral{Value: 1}
+	for i := 0; i < 3_000_000; i++ {
+		exp = &ast.PrefixExpression{Operator: "-", Right: exp}
+	}
+	program := &ast.Program{Statements: []ast.Statement{&ast.ExpressionStatement{Expression: exp}}}
+
+	evaluated := EvalContext(context.Background(), program, object.NewEnvironment(), Limits{})
+
+	err, ok := evaluated.(*object.LimitError)
+	if !ok {
+		t.Fatalf("no limit error. got=%T", evaluated)
+	}
+	if err.Message != "maximum nesting depth exceeded: 100000 nested nodes" {
+		t.Errorf("wrong message. got=%q", err.Message)
+	}
+}
+
+func TestEvalContextCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	evaluated := testEvalContext(ctx, "let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }; fib(20)", Limits{})
+
+	err, ok := evaluated.(*object.LimitError)
+	if !ok {
+		t.Fatalf("no limit error. got=%T (%+v)", evaluated, evaluated)
+	}
+	if err.Message != "evaluation canceled" {
+		t.Errorf("wrong message. got=%q", err.Message)
+	}
+}
+
+func testEvalContext(ctx context.Context, input string, limits Limits) object.Object {
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	env := object.NewEnvironment()
+
+	return EvalContext(ctx, program, env, limits)
+}
@@ -0,0 +1,217 @@
+// Package format prints Monkey programs in a canonical layout, one statement
+// per line, blocks indented with tabs and only the parentheses that are needed.
+// Comments are kept between the statements they were written between
+package format
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"waiig/ast"
+	"waiig/lexer"
+	"waiig/parser"
+)
+
+// Source parses src and returns it formatted. Programs with parse errors are
+// not formatted, the errors are returned instead
+func Source(src string) (string, []*parser.ParseError) {
+	p := parser.New(lexer.New(src, lexer.WithComments()))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return "", p.Errors()
+	}
+	return Program(program), nil
+}
+
+// Program returns the formatted source of a parsed program, with the comments
+// the parser collected when its lexer was created with lexer.WithComments
+func Program(program *ast.Program) string {
+	f := &formatter{out: &bytes.Buffer{}, comments: program.Comments}
+	f.statements(program.Statements, math.MaxInt)
+	return f.out.String()
+}
+
+type formatter struct {
+	out      *bytes.Buffer
+	indent   int
+	comments []*ast.Comment // the comments not printed yet, in input order
+}
+
+// statements prints a list of statements with the comments in between, end is
+// the offset where the list ends in the input
+func (f *formatter) statements(stmts []ast.Statement, end int) {
+	for i, s := range stmts {
+		f.commentsBefore(s.Pos().Offset)
+
+		start := f.out.Len()
+		f.statement(s)
+
+		next := end
+		if i+1 < len(stmts) {
+			next = stmts[i+1].Pos().Offset
+		}
+		f.trailingComment(s, start, next)
+	}
+	f.commentsBefore(end)
+}
+
+// commentsBefore prints the comments before offset on lines of their own.
+// Comments inside an expression end up after its statement
+func (f *formatter) commentsBefore(offset int) {
+	for len(f.comments) > 0 && f.comments[0].Pos().Offset < offset {
+		f.line(f.comments[0].String())
+		f.comments = f.comments[1:]
+	}
+}
+
+// trailingComment keeps a comment on the line of the statement before it, if
+// they were on the same line and the statement was printed on a single line
+func (f *formatter) trailingComment(s ast.Statement, start, next int) {
+	if len(f.comments) == 0 {
+		return
+	}
+	c := f.comments[0]
+	if c.Pos().Line != s.Pos().Line || c.Pos().Offset > next {
+		return
+	}
+	if bytes.Count(f.out.Bytes()[start:], []byte("\n")) != 1 {
+		return
+	}
+
+	f.out.Truncate(f.out.Len() - 1)
+	f.out.WriteString(" " + c.String() + "\n")
+	f.comments = f.comments[1:]
+}
+
+func (f *formatter) line(s string) {
+	f.out.WriteString(strings.Repeat("\t", f.indent))
+	f.out.WriteString(s)
+	f.out.WriteString("\n")
+}
+
+func (f *formatter) statement(s ast.Statement) {
+	switch s := s.(type) {
+	case *ast.LetStatement:
+		f.line("let " + s.Name.Value + " = " + f.expression(s.Value) + ";")
+	case *ast.ReturnStatement:
+		f.line("return " + f.expression(s.Value) + ";")
+	case *ast.ExpressionStatement:
+		// an if reads like a statement, a semicolon after its block would be noise
+		if _, ok := s.Expression.(*ast.IfExpression); ok {
+			f.line(f.expression(s.Expression))
+		} else {
+			f.line(f.expression(s.Expression) + ";")
+		}
+	default:
+		f.line(s.String())
+	}
+}
+
+// expression returns the formatted expression. Blocks inside it span several
+// lines, indented relative to the line the expression starts on
+func (f *formatter) expression(e ast.Expression) string {
+	switch e := e.(type) {
+	case *ast.PrefixExpression:
+		if _, ok := e.Right.(*ast.InfixExpression); ok {
+			return e.Operator + "(" + f.expression(e.Right) + ")"
+		}
+		return e.Operator + f.expression(e.Right)
+
+	case *ast.InfixExpression:
+		prec := parser.Precedence(e.Token.Type)
+
+		left := f.expression(e.Left)
+		if needsParens(e.Left, prec, false) {
+			left = "(" + left + ")"
+		}
+		right := f.expression(e.Right)
+		if needsParens(e.Right, prec, true) {
+			right = "(" + right + ")"
+		}
+		return left + " " + e.Operator + " " + right
+
+	case *ast.IfExpression:
+		out := "if (" + f.expression(e.Condition) + ") " + f.block(e.Consequence)
+		if e.Alternative != nil {
+			out += " else " + f.block(e.Alternative)
+		}
+		return out
+
+	case *ast.FunctionLiteral:
+		params := []string{}
+		for _, p := range e.Parameters {
+			params = append(params, p.Value)
+		}
+		return "fn(" + strings.Join(params, ", ") + ") " + f.block(e.Body)
+
+	case *ast.CallExpression:
+		return f.operand(e.Function) + "(" + f.list(e.Arguments) + ")"
+
+	case *ast.ArrayLiteral:
+		return "[" + f.list(e.Elements) + "]"
+
+	case *ast.IndexExpression:
+		return f.operand(e.Left) + "[" + f.expression(e.Index) + "]"
+
+	case *ast.HashLiteral:
+		pairs := []string{}
+		for i, key := range e.Keys {
+			pairs = append(pairs, f.expression(key)+": "+f.expression(e.Values[i]))
+		}
+		return "{" + strings.Join(pairs, ", ") + "}"
+
+	case *ast.IntegerLiteral, *ast.FloatLiteral:
+		// keep the base, underscores and exponent the number was written with
+		return e.TokenLiteral()
+
+	default:
+		// identifiers and literals print the way they're written
+		return e.String()
+	}
+}
+
+// operand formats the expression a call or index applies to, which only needs parentheses when it's an operator expression itself
+func (f *formatter) operand(e ast.Expression) string {
+	switch e.(type) {
+	case *ast.InfixExpression, *ast.PrefixExpression:
+		return "(" + f.expression(e) + ")"
+	default:
+		return f.expression(e)
+	}
+}
+
+func (f *formatter) list(exps []ast.Expression) string {
+	out := []string{}
+	for _, e := range exps {
+		out = append(out, f.expression(e))
+	}
+	return strings.Join(out, ", ")
+}
+
+func (f *formatter) block(b *ast.BlockStatement) string {
+	out := f.out
+	f.out = &bytes.Buffer{}
+	f.indent++
+	f.statements(b.Statements, b.End.Offset)
+	inner := f.out.String()
+	f.out = out
+	f.indent--
+
+	if inner == "" {
+		return "{}"
+	}
+	return "{\n" + inner + strings.Repeat("\t", f.indent) + "}"
+}
+
+// needsParens reports whether the operand of an infix operator with the given
+// precedence has to be parenthesized. Operators are left associative, so an
+// operand on the right needs them for equal precedence as well
+func needsParens(operand ast.Expression, prec int, right bool) bool {
+	infix, ok := operand.(*ast.InfixExpression)
+	if !ok {
+		return false
+	}
+
+	operandPrec := parser.Precedence(infix.Token.Type)
+	return operandPrec < prec || (right && operandPrec == prec)
+}
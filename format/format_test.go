@@ -0,0 +1,128 @@
+package format
+
+import (
+	"testing"
+	"waiig/lexer"
+	"waiig/parser"
+)
+
+func TestSource(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let   x=5", "let x = 5;\n"},
+		{"return x+1", "return x + 1;\n"},
+		{"a + b * c; (a + b) * c", "a + b * c;\n(a + b) * c;\n"},
+		{"a - (b - c); (a - b) - c", "a - (b - c);\na - b - c;\n"},
+		{"-(a + b); !-a; (-a)[0]; -a[0]", "-(a + b);\n!-a;\n(-a)[0];\n-a[0];\n"},
+		{"(a + b)(c)", "(a + b)(c);\n"},
+		{"0xff+1_000*2.50e3", "0xff + 1_000 * 2.50e3;\n"},
+		{"a||(b&&c); (a||b)&&c", "a || b && c;\n(a || b) && c;\n"},
+		{"(x&1)==0; x<<(1+2)>=y%2", "x & 1 == 0;\nx << 1 + 2 >= y % 2;\n"},
+		{"x&(1+2); (a|b)*c; a|(b^c); (a+b)|c", "x & (1 + 2);\n(a | b) * c;\na | (b ^ c);\na + b | c;\n"},
+		{`["a",1,[true]] ; {"k":   "v\n", 1: 2}`, "[\"a\", 1, [true]];\n{\"k\": \"v\\n\", 1: 2};\n"},
+		{
+			"let add = fn(a, b) { a + b };",
+			"let add = fn(a, b) {\n\ta + b;\n};\n",
+		},
+		{
+			"if (x > 1) { let y = x; if (y) { y } } else { fn() {} }",
+			"if (x > 1) {\n\tlet y = x;\n\tif (y) {\n\t\ty;\n\t}\n} else {\n\tfn() {};\n}\n",
+		},
+		{
+			"map([1, 2], fn(x) { x * 2 })",
+			"map([1, 2], fn(x) {\n\tx * 2;\n});\n",
+		},
+	}
+
+	for _, tt := range tests {
+		formatted, errs := Source(tt.input)
+		if len(errs) != 0 {
+			t.Fatalf("unexpected parse errors for %q: %v", tt.input, errs)
+		}
+
+		if formatted != tt.expected {
+			t.Errorf("wrong format for %q.\nwant=%q\ngot =%q", tt.input, tt.expected, formatted)
+		}
+	}
+}
+
+func TestSourceKeepsMeaning(t *testing.T) {
+	inputs := []string{
+		"a + b * c - d / e; a * (b + c); -(a - b) * c",
+		"a < b == c > d; a == (b == c)",
+		"1.5 * 0x10 - 1e3 / (0b1 - 2.0)",
+		"a || b && !c; (a || b) && c; x & 1 == 0; x & (1 == 0); (a | b) ^ c & d; a | (b ^ c) + d & e; 1 << 2 % 3 <= 4 >> (1 - 1)",
+		"add(a, b)[1] + fn(x) { x }(2) * [1, 2][0]",
+		`let h = {"one": 1, true: fn() { return -1; }}; h["one"]`,
+	}
+
+	for _, input := range inputs {
+		formatted, errs := Source(input)
+		if len(errs) != 0 {
+			t.Fatalf("unexpected parse errors for %q: %v", input, errs)
+		}
+
+		again, errs := Source(formatted)
+		if len(errs) != 0 {
+			t.Fatalf("formatted source doesn't parse: %q: %v", formatted, errs)
+		}
+		if again != formatted {
+			t.Errorf("formatting isn't stable.\nfirst =%q\nsecond=%q", formatted, again)
+		}
+
+		if parse(t, input) != parse(t, formatted) {
+			t.Errorf("formatting changed the program.\nbefore=%q\nafter =%q", parse(t, input), parse(t, formatted))
+		}
+	}
+}
+
+func TestSourceComments(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"// header\nlet x=1 // one\n\n\n// end", "// header\nlet x = 1; // one\n// end\n"},
+		{
+			"/// adds\nlet add=fn(a,b){ // args\n  a+b   /* sum */\n  // last\n}",
+			"/// adds\nlet add = fn(a, b) {\n\t// args\n\ta + b; /* sum */\n\t// last\n};\n",
+		},
+		{"if (x) { /* nothing */ }", "if (x) {\n\t/* nothing */\n}\n"},
+		{"a; b; // b", "a;\nb; // b\n"},
+		{"let x = [1, // one\n2];", "let x = [1, 2]; // one\n"},
+	}
+
+	for _, tt := range tests {
+		formatted, errs := Source(tt.input)
+		if len(errs) != 0 {
+			t.Fatalf("unexpected parse errors for %q: %v", tt.input, errs)
+		}
+
+		if formatted != tt.expected {
+			t.Errorf("wrong format for %q.\nwant=%q\ngot =%q", tt.input, tt.expected, formatted)
+		}
+	}
+}
+
+func TestSourceErrors(t *testing.T) {
+	formatted, errs := Source("let = 5;")
+	if len(errs) == 0 {
+		t.Fatalf("expected parse errors, got formatted source %q", formatted)
+	}
+	if formatted != "" {
+		t.Errorf("expected no output for a broken program, got=%q", formatted)
+	}
+}
+
+// parse returns the fully parenthesized form of the program
+func parse(t *testing.T, input string) string {
+	t.Helper()
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parse errors for %q: %v", input, p.Errors())
+	}
+	return program.String()
+}
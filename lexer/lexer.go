@@ -1,41 +1,103 @@
 package lexer
 
 import (
+	"bufio"
 	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
 	"waiig/token"
 )
 
+// Lexer reads the input one rune at a time, so it only holds on to the text of
+// the token it's reading and not the whole program
 type Lexer struct {
-	input        string
-	position     int  // current position in input (points to current char)
-	readPosition int  // current reading position in input (after current char)
-	ch           byte // current char under examination
+	reader   *bufio.Reader
+	position int               // current position in input (points to current char)
+	ch       rune              // current char under examination
+	width    int               // bytes the current char takes in the input
+	raw      [utf8.UTFMax]byte // the bytes of the current char as they are in the input
+	eof      bool              // the input is exhausted, ch is the 0 that ends it
+	text     []byte            // the chars read since the current token or comment started
+	line     int               // line of the current char
+	column   int               // column of the current char, counted in runes
+	errors   []*Error
+	comments bool // produce COMMENT tokens instead of skipping comments
 }
 
-func New(input string) *Lexer {
-	l := &Lexer{input: input}
+// Option configures a Lexer
+type Option func(*Lexer)
+
+// WithComments makes the lexer produce a COMMENT token for every comment,
+// whose literal is the whole comment including the // or /* */
+func WithComments() Option {
+	return func(l *Lexer) { l.comments = true }
+}
+
+// Error is a problem found while lexing
+type Error struct {
+	Pos     token.Position
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Pos, e.Message)
+}
+
+func New(input string, opts ...Option) *Lexer {
+	return NewReader(strings.NewReader(input), opts...)
+}
+
+// NewReader returns a lexer that reads the input from r as it goes, the tokens
+// are the same New returns for the whole input as a string. A read error ends
+// the input and is reported like the other problems the lexer finds
+func NewReader(r io.Reader, opts ...Option) *Lexer {
+	l := &Lexer{reader: bufio.NewReader(r), line: 1}
+	for _, opt := range opts {
+		opt(l)
+	}
 	l.readChar()
+
+	// scripts can start with a #! line to be run directly, it isn't Monkey
+	if l.ch == '#' && l.peekChar() == '!' {
+		for l.ch != '\n' && l.ch != 0 {
+			l.readChar()
+		}
+	}
+
 	return l
 }
 
-func (l *Lexer) peekChar() byte {
-	if l.readPosition > len(l.input) {
+// Errors returns the problems found while lexing, every ILLEGAL token the
+// lexer produces has a matching entry here
+func (l *Lexer) Errors() []*Error {
+	return l.errors
+}
+
+func (l *Lexer) peekChar() rune {
+	if l.eof {
+		return 0
+	}
+	next, _ := l.peekRune()
+	if len(next) == 0 {
 		return 0
-	} else {
-		return l.input[l.readPosition]
 	}
+	ch, _ := utf8.DecodeRune(next)
+	return ch
 }
 
 func (l *Lexer) NextToken() token.Token {
 	var tok token.Token
 
 	l.skipWhitespace()
+	pos := l.currentPosition()
+
 	switch l.ch {
 	case '=':
 		if l.peekChar() == '=' {
-			tok.Literal = fmt.Sprintf("%s%s", string(l.input[l.position]), string(l.input[l.readPosition]))
-			tok.Type = token.EQ
-			l.readChar()
+			tok = l.twoCharToken(token.EQ)
 		} else {
 			tok = newToken(token.ASSIGN, l.ch)
 		}
@@ -55,77 +117,426 @@ func (l *Lexer) NextToken() token.Token {
 		tok = newToken(token.LBRACE, l.ch)
 	case '}':
 		tok = newToken(token.RBRACE, l.ch)
+	case '[':
+		tok = newToken(token.LBRACKET, l.ch)
+	case ']':
+		tok = newToken(token.RBRACKET, l.ch)
+	case ':':
+		tok = newToken(token.COLON, l.ch)
 	case '!':
 		if l.peekChar() == '=' {
-			tok.Literal = fmt.Sprintf("%s%s", string(l.input[l.position]), string(l.input[l.readPosition]))
-			tok.Type = token.NOT_EQ
-			l.readChar()
+			tok = l.twoCharToken(token.NOT_EQ)
 		} else {
 			tok = newToken(token.BANG, l.ch)
 		}
 	case '*':
 		tok = newToken(token.ASTERISK, l.ch)
 	case '/':
+		if l.atComment() {
+			literal, ok := l.readComment()
+			tok = token.Token{Type: token.COMMENT, Literal: literal, Pos: pos}
+			if !ok {
+				tok.Type = token.ILLEGAL
+			}
+			return tok
+		}
 		tok = newToken(token.SLASH, l.ch)
+	case '%':
+		tok = newToken(token.PERCENT, l.ch)
 	case '<':
-		tok = newToken(token.LT, l.ch)
+		switch l.peekChar() {
+		case '=':
+			tok = l.twoCharToken(token.LT_EQ)
+		case '<':
+			tok = l.twoCharToken(token.SHIFT_LEFT)
+		default:
+			tok = newToken(token.LT, l.ch)
+		}
 	case '>':
-		tok = newToken(token.GT, l.ch)
+		switch l.peekChar() {
+		case '=':
+			tok = l.twoCharToken(token.GT_EQ)
+		case '>':
+			tok = l.twoCharToken(token.SHIFT_RIGHT)
+		default:
+			tok = newToken(token.GT, l.ch)
+		}
+	case '&':
+		if l.peekChar() == '&' {
+			tok = l.twoCharToken(token.AND)
+		} else {
+			tok = newToken(token.AMPERSAND, l.ch)
+		}
+	case '|':
+		if l.peekChar() == '|' {
+			tok = l.twoCharToken(token.OR)
+		} else {
+			tok = newToken(token.PIPE, l.ch)
+		}
+	case '^':
+		tok = newToken(token.CARET, l.ch)
+	case '"':
+		literal, ok := l.readString()
+		tok.Literal = literal
+		if ok {
+			tok.Type = token.STRING
+		} else {
+			tok.Type = token.ILLEGAL
+			tok.Pos = pos
+			return tok
+		}
 	case 0:
 		tok.Literal = ""
 		tok.Type = token.EOF
 	default:
 		if isLetter(l.ch) {
-			tok.Literal = l.readWord(isLetter)
+			tok.Literal = l.readWord(isIdentifierChar)
 			tok.Type = token.LookupIdent(tok.Literal)
+			tok.Pos = pos
 			return tok
 		} else if isDigit(l.ch) {
-			tok.Literal = l.readWord(isDigit)
-			tok.Type = token.INT
+			tok.Literal, tok.Type = l.readNumber()
+			tok.Pos = pos
 			return tok
+		} else if l.invalidChar() {
+			l.error("invalid UTF-8 encoding")
+			tok = token.Token{Type: token.ILLEGAL, Literal: string(l.raw[:l.width])}
 		} else {
+			l.error("illegal character %q", l.ch)
 			tok = newToken(token.ILLEGAL, l.ch)
 		}
 	}
 
 	l.readChar()
+	tok.Pos = pos
 	return tok
 }
 
-type charIdentificator func(byte) bool
+// twoCharToken reads the char after the current one, which the caller peeked
+// at, and returns both as a token of the given type
+func (l *Lexer) twoCharToken(tokenType token.TokenType) token.Token {
+	ch := l.ch
+	l.readChar()
+	return token.Token{Type: tokenType, Literal: string(ch) + string(l.ch)}
+}
+
+type charIdentificator func(rune) bool
 
 func (l *Lexer) readWord(fn charIdentificator) string {
-	position := l.position
+	from := len(l.text)
 	for fn(l.ch) {
 		l.readChar()
 	}
-	return l.input[position:l.position]
+	return string(l.text[from:])
+}
+
+// readNumber reads an integer, which may have a 0x, 0o or 0b prefix, or a
+// decimal float with a fraction, an exponent or both. Digits can be separated
+// with underscores. A malformed number is reported and returned as ILLEGAL
+func (l *Lexer) readNumber() (string, token.TokenType) {
+	start := l.currentPosition()
+	from := len(l.text)
+	tokenType := token.TokenType(token.INT)
+
+	base, name := 10, "decimal"
+	if l.ch == '0' {
+		switch l.peekChar() {
+		case 'x', 'X':
+			base, name = 16, "hexadecimal"
+		case 'o', 'O':
+			base, name = 8, "octal"
+		case 'b', 'B':
+			base, name = 2, "binary"
+		}
+		if base != 10 {
+			l.readChar()
+			l.readChar()
+		}
+	}
+
+	digits := l.position
+	l.readDigits(base)
+	if l.position == digits {
+		l.errorAt(start, "%s literal has no digits", name)
+		return string(l.text[from:]), token.ILLEGAL
+	}
+
+	if base == 10 && l.ch == '.' && isDigit(l.peekChar()) {
+		tokenType = token.FLOAT
+		l.readChar()
+		l.readDigits(10)
+	}
+	if base == 10 && (l.ch == 'e' || l.ch == 'E') {
+		if next := l.peekChar(); isDigit(next) || next == '+' || next == '-' {
+			tokenType = token.FLOAT
+			l.readChar()
+			if l.ch == '+' || l.ch == '-' {
+				l.readChar()
+			}
+			exponent := l.position
+			l.readDigits(10)
+			if l.position == exponent {
+				l.errorAt(start, "exponent has no digits")
+				return string(l.text[from:]), token.ILLEGAL
+			}
+		}
+	}
+
+	literal := string(l.text[from:])
+	if msg := checkDigits(literal, base, name); msg != "" {
+		l.errorAt(start, msg)
+		return literal, token.ILLEGAL
+	}
+	return literal, tokenType
+}
+
+// readDigits reads the digits of a number and the underscores between them.
+// Decimal digits are read for any base so checkDigits can report them
+func (l *Lexer) readDigits(base int) {
+	for isDigit(l.ch) || l.ch == '_' || base == 16 && isHexDigit(l.ch) {
+		l.readChar()
+	}
+}
+
+// checkDigits returns why literal isn't a valid number of the base, or "" if
+// it is. Underscores have to be between digits, or right after the prefix
+func checkDigits(literal string, base int, name string) string {
+	isBaseDigit := isDigit
+	if base == 16 {
+		isBaseDigit = isHexDigit
+	}
+
+	for i := 0; i < len(literal); i++ {
+		ch := rune(literal[i])
+		switch {
+		case ch == '_':
+			afterDigit := i > 0 && isBaseDigit(rune(literal[i-1])) || base != 10 && i == 2
+			beforeDigit := i+1 < len(literal) && isBaseDigit(rune(literal[i+1]))
+			if !afterDigit || !beforeDigit {
+				return "'_' must separate successive digits"
+			}
+		case base < 10 && i >= 2 && isDigit(ch) && int(ch-'0') >= base:
+			return fmt.Sprintf("invalid digit %q in %s literal", ch, name)
+		}
+	}
+	return ""
 }
 
+// readString reads a double quoted string and returns its value with the
+// escape sequences resolved. If the input ends before the closing quote it
+// returns what was read so far and false
+func (l *Lexer) readString() (string, bool) {
+	var out strings.Builder
+	start := l.currentPosition()
+
+	for {
+		l.readChar()
+		switch l.ch {
+		case '"':
+			return out.String(), true
+		case 0:
+			l.errorAt(start, "unterminated string literal")
+			return out.String(), false
+		case '\\':
+			l.readEscape(&out)
+		default:
+			if l.invalidChar() {
+				l.error("invalid UTF-8 encoding")
+			}
+			out.WriteRune(l.ch)
+		}
+	}
+}
+
+// readEscape is called with l.ch on the backslash and leaves l.ch on the last
+// character of the escape sequence
+func (l *Lexer) readEscape(out *strings.Builder) {
+	start := l.currentPosition()
+	l.readChar()
+	switch l.ch {
+	case 'n':
+		out.WriteByte('\n')
+	case 't':
+		out.WriteByte('\t')
+	case 'r':
+		out.WriteByte('\r')
+	case '"':
+		out.WriteByte('"')
+	case '\\':
+		out.WriteByte('\\')
+	case 'u':
+		l.readUnicodeEscape(out, start)
+	case 0:
+		// readString reports the unterminated string
+	default:
+		l.errorAt(start, "unknown escape sequence \\%c", l.ch)
+	}
+}
+
+// readUnicodeEscape reads the {XXXX} part of a \u{XXXX} escape, start is the
+// position of the backslash
+func (l *Lexer) readUnicodeEscape(out *strings.Builder, start token.Position) {
+	if l.peekChar() != '{' {
+		l.errorAt(start, "invalid unicode escape, expected '{' after \\u")
+		return
+	}
+	l.readChar()
+
+	var hex strings.Builder
+	for isHexDigit(l.peekChar()) {
+		l.readChar()
+		hex.WriteRune(l.ch)
+	}
+	digits := hex.String()
+
+	if l.peekChar() != '}' {
+		l.errorAt(start, "invalid unicode escape, expected '}' after \\u{%s", digits)
+		return
+	}
+	l.readChar()
+
+	code, err := strconv.ParseUint(digits, 16, 32)
+	if err != nil || len(digits) > 6 || !utf8.ValidRune(rune(code)) {
+		l.errorAt(start, "invalid unicode code point \\u{%s}", digits)
+		return
+	}
+	out.WriteRune(rune(code))
+}
+
+// error reports a problem at the current char
+func (l *Lexer) error(format string, a ...interface{}) {
+	l.errorAt(l.currentPosition(), format, a...)
+}
+
+func (l *Lexer) errorAt(pos token.Position, format string, a ...interface{}) {
+	l.errors = append(l.errors, &Error{Pos: pos, Message: fmt.Sprintf(format, a...)})
+}
+
+func (l *Lexer) currentPosition() token.Position {
+	return token.Position{Offset: l.position, Line: l.line, Column: l.column}
+}
+
+// skipWhitespace skips whitespace, and comments as well unless the lexer
+// produces tokens for them
 func (l *Lexer) skipWhitespace() {
-	for l.ch == ' ' || l.ch == '\t' || l.ch == '\n' || l.ch == '\r' {
+	for {
+		// nothing skipped is part of a token
+		l.text = l.text[:0]
+
+		switch {
+		case l.ch == ' ' || l.ch == '\t' || l.ch == '\n' || l.ch == '\r':
+			l.readChar()
+		case !l.comments && l.atComment():
+			l.readComment()
+		default:
+			return
+		}
+	}
+}
+
+func (l *Lexer) atComment() bool {
+	return l.ch == '/' && (l.peekChar() == '/' || l.peekChar() == '*')
+}
+
+// readComment reads a // comment up to the end of the line or a /* */ comment,
+// which may nest, and leaves l.ch after it. If the input ends inside a block
+// comment it returns what was read and false
+func (l *Lexer) readComment() (string, bool) {
+	start := l.currentPosition()
+	from := len(l.text)
+
+	if l.peekChar() == '/' {
+		for l.ch != '\n' && l.ch != 0 {
+			l.readChar()
+		}
+		return string(l.text[from:]), true
+	}
+
+	l.readChar()
+	l.readChar()
+	for depth := 1; depth > 0; {
+		switch {
+		case l.ch == 0:
+			l.errorAt(start, "unterminated block comment")
+			return string(l.text[from:]), false
+		case l.ch == '/' && l.peekChar() == '*':
+			depth++
+			l.readChar()
+		case l.ch == '*' && l.peekChar() == '/':
+			depth--
+			l.readChar()
+		}
 		l.readChar()
 	}
+	return string(l.text[from:]), true
 }
 
+// readChar moves to the next rune of the input. Bytes that aren't valid UTF-8
+// are read one at a time as utf8.RuneError, see invalidChar
 func (l *Lexer) readChar() {
-	if l.readPosition >= len(l.input) {
-		l.ch = 0
-	} else {
-		l.ch = l.input[l.readPosition]
+	if l.eof {
+		// already at the end, stay there so EOF keeps its position
+		return
+	}
+	if l.ch == '\n' {
+		l.line++
+		l.column = 0
+	}
+	l.column++
+	l.position += l.width
+	l.text = append(l.text, l.raw[:l.width]...)
+
+	next, err := l.peekRune()
+	if len(next) == 0 {
+		if err != io.EOF {
+			l.error("read error: %s", err)
+		}
+		l.ch, l.width, l.eof = 0, 0, true
+		return
 	}
-	l.position = l.readPosition
-	l.readPosition += 1
+
+	l.ch, l.width = utf8.DecodeRune(next)
+	copy(l.raw[:], next[:l.width])
+	l.reader.Discard(l.width)
 }
 
-func isLetter(ch byte) bool {
-	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_'
+// peekRune returns the bytes of the next rune without reading them. It asks
+// for one more byte at a time as long as the rune is incomplete, asking for
+// utf8.UTFMax bytes right away would wait for input the rune doesn't need, so a
+// token at the end of what a pipe has delivered would be held back
+func (l *Lexer) peekRune() ([]byte, error) {
+	next, err := l.reader.Peek(1)
+	for n := 2; err == nil && !utf8.FullRune(next) && n <= utf8.UTFMax; n++ {
+		next, err = l.reader.Peek(n)
+	}
+	return next, err
 }
 
-func isDigit(ch byte) bool {
+// invalidChar tells a byte that isn't valid UTF-8 apart from a U+FFFD that's
+// really in the input
+func (l *Lexer) invalidChar() bool {
+	return l.ch == utf8.RuneError && l.width == 1
+}
+
+func isLetter(ch rune) bool {
+	return unicode.IsLetter(ch) || ch == '_'
+}
+
+// isIdentifierChar is true for the chars after the first one of an identifier,
+// which may be digits as well
+func isIdentifierChar(ch rune) bool {
+	return isLetter(ch) || unicode.IsDigit(ch)
+}
+
+// isDigit only accepts ASCII digits, those are the ones number literals use
+func isDigit(ch rune) bool {
 	return '0' <= ch && ch <= '9'
 }
 
-func newToken(tokenType token.TokenType, ch byte) token.Token {
+func isHexDigit(ch rune) bool {
+	return isDigit(ch) || 'a' <= ch && ch <= 'f' || 'A' <= ch && ch <= 'F'
+}
+
+func newToken(tokenType token.TokenType, ch rune) token.Token {
 	return token.Token{Type: tokenType, Literal: string(ch)}
 }
@@ -1,7 +1,13 @@
 package lexer
 
 import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
 	"testing"
+	"testing/iotest"
+	"time"
 	"waiig/token"
 )
 
@@ -118,7 +124,7 @@ let add = fn(x, y) {
 };
 
 let result = add(five, ten);
-!-/*5;
+!-/ *5;
 5 < 10 > 5;
 
 if (5 < 10) {
@@ -129,6 +135,8 @@ if (5 < 10) {
 
 10 == 10;
 10 != 9;
+[1, 2];
+{"foo": "bar"}
 `
 
 	tests := []struct {
@@ -208,6 +216,57 @@ if (5 < 10) {
 		{token.NOT_EQ, "!="},
 		{token.INT, "9"},
 		{token.SEMICOLON, ";"},
+		{token.LBRACKET, "["},
+		{token.INT, "1"},
+		{token.COMMA, ","},
+		{token.INT, "2"},
+		{token.RBRACKET, "]"},
+		{token.SEMICOLON, ";"},
+		{token.LBRACE, "{"},
+		{token.STRING, "foo"},
+		{token.COLON, ":"},
+		{token.STRING, "bar"},
+		{token.RBRACE, "}"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestNextToken_strings(t *testing.T) {
+	input := `"foobar"
+"foo bar"
+"tab\there\nnewline"
+"\"quoted\" \\ backslash"
+"\u{48}\u{1F600}"
+""
+"unterminated`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.STRING, "foobar"},
+		{token.STRING, "foo bar"},
+		{token.STRING, "tab\there\nnewline"},
+		{token.STRING, "\"quoted\" \\ backslash"},
+		{token.STRING, "H\U0001F600"},
+		{token.STRING, ""},
+		{token.ILLEGAL, "unterminated"},
 		{token.EOF, ""},
 	}
 
@@ -226,4 +285,741 @@ if (5 < 10) {
 				i, tt.expectedLiteral, tok.Literal)
 		}
 	}
+
+	if len(l.Errors()) != 1 || l.Errors()[0].Error() != "7:1: unterminated string literal" {
+		t.Errorf("wrong lexer errors. got=%q", l.Errors())
+	}
+}
+
+func TestNextToken_invalidEscapes(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedError string
+	}{
+		{`"\x"`, `1:2: unknown escape sequence \x`},
+		{`"\u0041"`, `1:2: invalid unicode escape, expected '{' after \u`},
+		{`"\u{41"`, `1:2: invalid unicode escape, expected '}' after \u{41`},
+		{`"\u{110000}"`, `1:2: invalid unicode code point \u{110000}`},
+		{`"\u{}"`, `1:2: invalid unicode code point \u{}`},
+	}
+
+	for _, tt := range tests {
+		l := New(tt.input)
+		for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		}
+
+		if len(l.Errors()) == 0 || l.Errors()[0].Error() != tt.expectedError {
+			t.Errorf("wrong lexer errors for %q. expected=%q, got=%q", tt.input, tt.expectedError, l.Errors())
+		}
+	}
+}
+
+func TestNextToken_positions(t *testing.T) {
+	input := `let x = 5;
+  x + "a
+b";
+`
+
+	tests := []struct {
+		expectedType token.TokenType
+		expectedPos  token.Position
+	}{
+		{token.LET, token.Position{Offset: 0, Line: 1, Column: 1}},
+		{token.IDENT, token.Position{Offset: 4, Line: 1, Column: 5}},
+		{token.ASSIGN, token.Position{Offset: 6, Line: 1, Column: 7}},
+		{token.INT, token.Position{Offset: 8, Line: 1, Column: 9}},
+		{token.SEMICOLON, token.Position{Offset: 9, Line: 1, Column: 10}},
+		{token.IDENT, token.Position{Offset: 13, Line: 2, Column: 3}},
+		{token.PLUS, token.Position{Offset: 15, Line: 2, Column: 5}},
+		{token.STRING, token.Position{Offset: 17, Line: 2, Column: 7}},
+		{token.SEMICOLON, token.Position{Offset: 22, Line: 3, Column: 3}},
+		{token.EOF, token.Position{Offset: 24, Line: 4, Column: 1}},
+		{token.EOF, token.Position{Offset: 24, Line: 4, Column: 1}},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Pos != tt.expectedPos {
+			t.Fatalf("tests[%d] - position wrong. expected=%+v, got=%+v",
+				i, tt.expectedPos, tok.Pos)
+		}
+	}
+}
+
+func TestNextToken_shebang(t *testing.T) {
+	tests := []struct {
+		input        string
+		expectedType token.TokenType
+		expectedPos  token.Position
+	}{
+		{"#!/usr/bin/env waiig run\nlet", token.LET, token.Position{Offset: 25, Line: 2, Column: 1}},
+		{"#!waiig", token.EOF, token.Position{Offset: 7, Line: 1, Column: 8}},
+		{" #!waiig", token.ILLEGAL, token.Position{Offset: 1, Line: 1, Column: 2}},
+	}
+
+	for i, tt := range tests {
+		tok := New(tt.input).NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Errorf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+		if tok.Pos != tt.expectedPos {
+			t.Errorf("tests[%d] - position wrong. expected=%+v, got=%+v", i, tt.expectedPos, tok.Pos)
+		}
+	}
+}
+
+func TestNextToken_unicode(t *testing.T) {
+	input := `let café = "naïve ☕";
+let π2 = größe + 日本;
+"🐒"; x1`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+		expectedPos     token.Position
+	}{
+		{token.LET, "let", token.Position{Offset: 0, Line: 1, Column: 1}},
+		{token.IDENT, "café", token.Position{Offset: 4, Line: 1, Column: 5}},
+		{token.ASSIGN, "=", token.Position{Offset: 10, Line: 1, Column: 10}},
+		{token.STRING, "naïve ☕", token.Position{Offset: 12, Line: 1, Column: 12}},
+		{token.SEMICOLON, ";", token.Position{Offset: 24, Line: 1, Column: 21}},
+		{token.LET, "let", token.Position{Offset: 26, Line: 2, Column: 1}},
+		{token.IDENT, "π2", token.Position{Offset: 30, Line: 2, Column: 5}},
+		{token.ASSIGN, "=", token.Position{Offset: 34, Line: 2, Column: 8}},
+		{token.IDENT, "größe", token.Position{Offset: 36, Line: 2, Column: 10}},
+		{token.PLUS, "+", token.Position{Offset: 44, Line: 2, Column: 16}},
+		{token.IDENT, "日本", token.Position{Offset: 46, Line: 2, Column: 18}},
+		{token.SEMICOLON, ";", token.Position{Offset: 52, Line: 2, Column: 20}},
+		{token.STRING, "🐒", token.Position{Offset: 54, Line: 3, Column: 1}},
+		{token.SEMICOLON, ";", token.Position{Offset: 60, Line: 3, Column: 4}},
+		{token.IDENT, "x1", token.Position{Offset: 62, Line: 3, Column: 6}},
+		{token.EOF, "", token.Position{Offset: 64, Line: 3, Column: 8}},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+		if tok.Pos != tt.expectedPos {
+			t.Fatalf("tests[%d] - position wrong. expected=%+v, got=%+v", i, tt.expectedPos, tok.Pos)
+		}
+	}
+
+	if len(l.Errors()) != 0 {
+		t.Errorf("unexpected lexer errors: %v", l.Errors())
+	}
+}
+
+func TestNextToken_invalidUTF8(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedTypes  []token.TokenType
+		expectedErrors []string
+	}{
+		{
+			"let \xff = 1;",
+			[]token.TokenType{token.LET, token.ILLEGAL, token.ASSIGN, token.INT, token.SEMICOLON, token.EOF},
+			[]string{"1:5: invalid UTF-8 encoding"},
+		},
+		{
+			"ab\xc3(",
+			[]token.TokenType{token.IDENT, token.ILLEGAL, token.LPAREN, token.EOF},
+			[]string{"1:3: invalid UTF-8 encoding"},
+		},
+		{
+			"\"é\xe2\x82\" + 1",
+			[]token.TokenType{token.STRING, token.PLUS, token.INT, token.EOF},
+			[]string{"1:3: invalid UTF-8 encoding", "1:4: invalid UTF-8 encoding"},
+		},
+		{
+			// a replacement character that is really in the input is fine
+			"\"�\" ¿",
+			[]token.TokenType{token.STRING, token.ILLEGAL, token.EOF},
+			[]string{"1:5: illegal character '¿'"},
+		},
+	}
+
+	for _, tt := range tests {
+		l := New(tt.input)
+
+		for i, expectedType := range tt.expectedTypes {
+			tok := l.NextToken()
+			if tok.Type != expectedType {
+				t.Fatalf("%q: token %d - tokentype wrong. expected=%q, got=%q", tt.input, i, expectedType, tok.Type)
+			}
+		}
+
+		if len(l.Errors()) != len(tt.expectedErrors) {
+			t.Fatalf("%q: wrong number of errors. expected=%d, got=%v", tt.input, len(tt.expectedErrors), l.Errors())
+		}
+		for i, err := range l.Errors() {
+			if err.Error() != tt.expectedErrors[i] {
+				t.Errorf("%q: error %d wrong. expected=%q, got=%q", tt.input, i, tt.expectedErrors[i], err.Error())
+			}
+		}
+	}
+}
+
+func TestNextToken_comments(t *testing.T) {
+	input := `// leading
+let x = 1; // trailing
+/* block /* nested */ still comment */ x / 2
+/// doc
+`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+		expectedPos     token.Position
+	}{
+		{token.COMMENT, "// leading", token.Position{Offset: 0, Line: 1, Column: 1}},
+		{token.LET, "let", token.Position{Offset: 11, Line: 2, Column: 1}},
+		{token.IDENT, "x", token.Position{Offset: 15, Line: 2, Column: 5}},
+		{token.ASSIGN, "=", token.Position{Offset: 17, Line: 2, Column: 7}},
+		{token.INT, "1", token.Position{Offset: 19, Line: 2, Column: 9}},
+		{token.SEMICOLON, ";", token.Position{Offset: 20, Line: 2, Column: 10}},
+		{token.COMMENT, "// trailing", token.Position{Offset: 22, Line: 2, Column: 12}},
+		{token.COMMENT, "/* block /* nested */ still comment */", token.Position{Offset: 34, Line: 3, Column: 1}},
+		{token.IDENT, "x", token.Position{Offset: 73, Line: 3, Column: 40}},
+		{token.SLASH, "/", token.Position{Offset: 75, Line: 3, Column: 42}},
+		{token.INT, "2", token.Position{Offset: 77, Line: 3, Column: 44}},
+		{token.COMMENT, "/// doc", token.Position{Offset: 79, Line: 4, Column: 1}},
+		{token.EOF, "", token.Position{Offset: 87, Line: 5, Column: 1}},
+	}
+
+	withComments := New(input, WithComments())
+	withoutComments := New(input)
+
+	for i, tt := range tests {
+		tok := withComments.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+		if tok.Pos != tt.expectedPos {
+			t.Errorf("tests[%d] - position wrong. expected=%+v, got=%+v", i, tt.expectedPos, tok.Pos)
+		}
+
+		if tt.expectedType == token.COMMENT {
+			continue
+		}
+		if tok := withoutComments.NextToken(); tok != (token.Token{Type: tt.expectedType, Literal: tt.expectedLiteral, Pos: tt.expectedPos}) {
+			t.Errorf("tests[%d] - without comments expected %q at %s, got=%q at %s", i, tt.expectedLiteral, tt.expectedPos, tok.Literal, tok.Pos)
+		}
+	}
+}
+
+func TestNextToken_unterminatedComment(t *testing.T) {
+	input := "1 /* open /* nested */"
+
+	l := New(input, WithComments())
+	l.NextToken()
+	tok := l.NextToken()
+	if tok.Type != token.ILLEGAL || tok.Literal != "/* open /* nested */" {
+		t.Errorf("expected ILLEGAL for the unterminated comment, got=%+v", tok)
+	}
+
+	l = New(input)
+	l.NextToken()
+	if tok := l.NextToken(); tok.Type != token.EOF {
+		t.Errorf("expected EOF after skipping the comment, got=%+v", tok)
+	}
+	if len(l.Errors()) != 1 || l.Errors()[0].Error() != "1:3: unterminated block comment" {
+		t.Errorf("wrong errors. got=%v", l.Errors())
+	}
+}
+
+func TestNextToken_numbers(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedType    token.TokenType
+		expectedLiteral string
+		expectedError   string
+	}{
+		{"0", token.INT, "0", ""},
+		{"1_000_000", token.INT, "1_000_000", ""},
+		{"0xFF_ff", token.INT, "0xFF_ff", ""},
+		{"0o17", token.INT, "0o17", ""},
+		{"0B1010", token.INT, "0B1010", ""},
+		{"0x_1", token.INT, "0x_1", ""},
+		{"1.5", token.FLOAT, "1.5", ""},
+		{"1_0.2_5e-1_0", token.FLOAT, "1_0.2_5e-1_0", ""},
+		{"2E+3", token.FLOAT, "2E+3", ""},
+		{"3e8", token.FLOAT, "3e8", ""},
+		{"0x", token.ILLEGAL, "0x", "1:1: hexadecimal literal has no digits"},
+		{"0b102", token.ILLEGAL, "0b102", "1:1: invalid digit '2' in binary literal"},
+		{"0o8", token.ILLEGAL, "0o8", "1:1: invalid digit '8' in octal literal"},
+		{"1__0", token.ILLEGAL, "1__0", "1:1: '_' must separate successive digits"},
+		{"1_", token.ILLEGAL, "1_", "1:1: '_' must separate successive digits"},
+		{"1_.5", token.ILLEGAL, "1_.5", "1:1: '_' must separate successive digits"},
+		{"1e+", token.ILLEGAL, "1e+", "1:1: exponent has no digits"},
+	}
+
+	for _, tt := range tests {
+		l := New(tt.input)
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Errorf("%q: expected %s %q, got=%s %q", tt.input, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+		if next := l.NextToken(); next.Type != token.EOF {
+			t.Errorf("%q: expected the whole input to be read, got=%+v", tt.input, next)
+		}
+
+		errors := []string{}
+		for _, err := range l.Errors() {
+			errors = append(errors, err.Error())
+		}
+		if strings.Join(errors, "\n") != tt.expectedError {
+			t.Errorf("%q: wrong errors. expected=%q, got=%q", tt.input, tt.expectedError, errors)
+		}
+	}
+}
+
+func TestNextToken_numbersAndDots(t *testing.T) {
+	// a dot that isn't followed by a digit isn't part of the number
+	l := New("1.e")
+	for _, expected := range []token.TokenType{token.INT, token.ILLEGAL, token.IDENT, token.EOF} {
+		if tok := l.NextToken(); tok.Type != expected {
+			t.Fatalf("expected %s, got=%+v", expected, tok)
+		}
+	}
+}
+
+func TestNextToken_operators(t *testing.T) {
+	input := `a <= b >= c < d > e && f || g % h & i | j ^ k << l >> m <<= !== &&& |||`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.IDENT, "a"},
+		{token.LT_EQ, "<="},
+		{token.IDENT, "b"},
+		{token.GT_EQ, ">="},
+		{token.IDENT, "c"},
+		{token.LT, "<"},
+		{token.IDENT, "d"},
+		{token.GT, ">"},
+		{token.IDENT, "e"},
+		{token.AND, "&&"},
+		{token.IDENT, "f"},
+		{token.OR, "||"},
+		{token.IDENT, "g"},
+		{token.PERCENT, "%"},
+		{token.IDENT, "h"},
+		{token.AMPERSAND, "&"},
+		{token.IDENT, "i"},
+		{token.PIPE, "|"},
+		{token.IDENT, "j"},
+		{token.CARET, "^"},
+		{token.IDENT, "k"},
+		{token.SHIFT_LEFT, "<<"},
+		{token.IDENT, "l"},
+		{token.SHIFT_RIGHT, ">>"},
+		{token.IDENT, "m"},
+		{token.SHIFT_LEFT, "<<"},
+		{token.ASSIGN, "="},
+		{token.NOT_EQ, "!="},
+		{token.ASSIGN, "="},
+		{token.AND, "&&"},
+		{token.AMPERSAND, "&"},
+		{token.OR, "||"},
+		{token.PIPE, "|"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+type readerToken struct {
+	expectedType    token.TokenType
+	expectedLiteral string
+	expectedPos     string
+}
+
+type readerTest struct {
+	input          string
+	opts           []Option
+	expectedTokens []readerToken
+	expectedErrors []string
+}
+
+// readerTests cover everything the lexer reads, NewReader has to give these
+// tokens and errors however the reader hands out the bytes
+var readerTests = []readerTest{
+	{
+		"",
+		nil,
+		[]readerToken{
+			{token.EOF, "", "1:1"},
+		},
+		nil,
+	},
+	{
+		"let five = 5;\nlet add = fn(x, y) { x + y; };\n!-/ *5; 5 < 10 > 5; 10 == 10; 10 != 9;",
+		nil,
+		[]readerToken{
+			{token.LET, "let", "1:1"},
+			{token.IDENT, "five", "1:5"},
+			{token.ASSIGN, "=", "1:10"},
+			{token.INT, "5", "1:12"},
+			{token.SEMICOLON, ";", "1:13"},
+			{token.LET, "let", "2:1"},
+			{token.IDENT, "add", "2:5"},
+			{token.ASSIGN, "=", "2:9"},
+			{token.FUNCTION, "fn", "2:11"},
+			{token.LPAREN, "(", "2:13"},
+			{token.IDENT, "x", "2:14"},
+			{token.COMMA, ",", "2:15"},
+			{token.IDENT, "y", "2:17"},
+			{token.RPAREN, ")", "2:18"},
+			{token.LBRACE, "{", "2:20"},
+			{token.IDENT, "x", "2:22"},
+			{token.PLUS, "+", "2:24"},
+			{token.IDENT, "y", "2:26"},
+			{token.SEMICOLON, ";", "2:27"},
+			{token.RBRACE, "}", "2:29"},
+			{token.SEMICOLON, ";", "2:30"},
+			{token.BANG, "!", "3:1"},
+			{token.MINUS, "-", "3:2"},
+			{token.SLASH, "/", "3:3"},
+			{token.ASTERISK, "*", "3:5"},
+			{token.INT, "5", "3:6"},
+			{token.SEMICOLON, ";", "3:7"},
+			{token.INT, "5", "3:9"},
+			{token.LT, "<", "3:11"},
+			{token.INT, "10", "3:13"},
+			{token.GT, ">", "3:16"},
+			{token.INT, "5", "3:18"},
+			{token.SEMICOLON, ";", "3:19"},
+			{token.INT, "10", "3:21"},
+			{token.EQ, "==", "3:24"},
+			{token.INT, "10", "3:27"},
+			{token.SEMICOLON, ";", "3:29"},
+			{token.INT, "10", "3:31"},
+			{token.NOT_EQ, "!=", "3:34"},
+			{token.INT, "9", "3:37"},
+			{token.SEMICOLON, ";", "3:38"},
+			{token.EOF, "", "3:39"},
+		},
+		nil,
+	},
+	{
+		"[1, 2]; {\"foo\": \"bar\"}; \"tab\\there\\u{1F600}\" \"\\q\" \"\\u{110000}\" \"open",
+		nil,
+		[]readerToken{
+			{token.LBRACKET, "[", "1:1"},
+			{token.INT, "1", "1:2"},
+			{token.COMMA, ",", "1:3"},
+			{token.INT, "2", "1:5"},
+			{token.RBRACKET, "]", "1:6"},
+			{token.SEMICOLON, ";", "1:7"},
+			{token.LBRACE, "{", "1:9"},
+			{token.STRING, "foo", "1:10"},
+			{token.COLON, ":", "1:15"},
+			{token.STRING, "bar", "1:17"},
+			{token.RBRACE, "}", "1:22"},
+			{token.SEMICOLON, ";", "1:23"},
+			{token.STRING, "tab\there😀", "1:25"},
+			{token.STRING, "", "1:46"},
+			{token.STRING, "", "1:51"},
+			{token.ILLEGAL, "open", "1:64"},
+			{token.EOF, "", "1:69"},
+		},
+		[]string{"1:47: unknown escape sequence \\q", "1:52: invalid unicode code point \\u{110000}", "1:64: unterminated string literal"},
+	},
+	{
+		"a <= b >= c && d || e % f & g | h ^ i << j >> k",
+		nil,
+		[]readerToken{
+			{token.IDENT, "a", "1:1"},
+			{token.LT_EQ, "<=", "1:3"},
+			{token.IDENT, "b", "1:6"},
+			{token.GT_EQ, ">=", "1:8"},
+			{token.IDENT, "c", "1:11"},
+			{token.AND, "&&", "1:13"},
+			{token.IDENT, "d", "1:16"},
+			{token.OR, "||", "1:18"},
+			{token.IDENT, "e", "1:21"},
+			{token.PERCENT, "%", "1:23"},
+			{token.IDENT, "f", "1:25"},
+			{token.AMPERSAND, "&", "1:27"},
+			{token.IDENT, "g", "1:29"},
+			{token.PIPE, "|", "1:31"},
+			{token.IDENT, "h", "1:33"},
+			{token.CARET, "^", "1:35"},
+			{token.IDENT, "i", "1:37"},
+			{token.SHIFT_LEFT, "<<", "1:39"},
+			{token.IDENT, "j", "1:42"},
+			{token.SHIFT_RIGHT, ">>", "1:44"},
+			{token.IDENT, "k", "1:47"},
+			{token.EOF, "", "1:48"},
+		},
+		nil,
+	},
+	{
+		"0x_ff 1_000 0o17 0b102 1.5e-3 1e+ 1__0 1.e",
+		nil,
+		[]readerToken{
+			{token.INT, "0x_ff", "1:1"},
+			{token.INT, "1_000", "1:7"},
+			{token.INT, "0o17", "1:13"},
+			{token.ILLEGAL, "0b102", "1:18"},
+			{token.FLOAT, "1.5e-3", "1:24"},
+			{token.ILLEGAL, "1e+", "1:31"},
+			{token.ILLEGAL, "1__0", "1:35"},
+			{token.INT, "1", "1:40"},
+			{token.ILLEGAL, ".", "1:41"},
+			{token.IDENT, "e", "1:42"},
+			{token.EOF, "", "1:43"},
+		},
+		[]string{"1:18: invalid digit '2' in binary literal", "1:31: exponent has no digits", "1:35: '_' must separate successive digits", "1:41: illegal character '.'"},
+	},
+	{
+		"// line\nx /* block /* nested */ */ y /// doc\n/* open",
+		nil,
+		[]readerToken{
+			{token.IDENT, "x", "2:1"},
+			{token.IDENT, "y", "2:28"},
+			{token.EOF, "", "3:8"},
+		},
+		[]string{"3:1: unterminated block comment"},
+	},
+	{
+		"// line\nx /* block /* nested */ */ y /// doc\n/* open",
+		[]Option{WithComments()},
+		[]readerToken{
+			{token.COMMENT, "// line", "1:1"},
+			{token.IDENT, "x", "2:1"},
+			{token.COMMENT, "/* block /* nested */ */", "2:3"},
+			{token.IDENT, "y", "2:28"},
+			{token.COMMENT, "/// doc", "2:30"},
+			{token.ILLEGAL, "/* open", "3:1"},
+			{token.EOF, "", "3:8"},
+		},
+		[]string{"3:1: unterminated block comment"},
+	},
+	{
+		"#!/usr/bin/env waiig run\nlet 名前 = \"日本\"; ñ + _x1",
+		nil,
+		[]readerToken{
+			{token.LET, "let", "2:1"},
+			{token.IDENT, "名前", "2:5"},
+			{token.ASSIGN, "=", "2:8"},
+			{token.STRING, "日本", "2:10"},
+			{token.SEMICOLON, ";", "2:14"},
+			{token.IDENT, "ñ", "2:16"},
+			{token.PLUS, "+", "2:18"},
+			{token.IDENT, "_x1", "2:20"},
+			{token.EOF, "", "2:23"},
+		},
+		nil,
+	},
+	{
+		"let \xff = 1; \"é\xe2\x82\" ¿ \"�\" ab\xc3(",
+		nil,
+		[]readerToken{
+			{token.LET, "let", "1:1"},
+			{token.ILLEGAL, "\xff", "1:5"},
+			{token.ASSIGN, "=", "1:7"},
+			{token.INT, "1", "1:9"},
+			{token.SEMICOLON, ";", "1:10"},
+			{token.STRING, "é��", "1:12"},
+			{token.ILLEGAL, "¿", "1:18"},
+			{token.STRING, "�", "1:20"},
+			{token.IDENT, "ab", "1:24"},
+			{token.ILLEGAL, "\xc3", "1:26"},
+			{token.LPAREN, "(", "1:27"},
+			{token.EOF, "", "1:28"},
+		},
+		[]string{"1:5: invalid UTF-8 encoding", "1:14: invalid UTF-8 encoding", "1:15: invalid UTF-8 encoding", "1:18: illegal character '¿'", "1:26: invalid UTF-8 encoding"},
+	},
+	{
+		"1 \x00 2",
+		nil,
+		[]readerToken{
+			{token.INT, "1", "1:1"},
+			{token.EOF, "", "1:3"},
+		},
+		nil,
+	},
+}
+
+// repeatedReaderTest is long enough to cross the reader's buffer, with runes of
+// every width in the string, the identifier and the comment
+func repeatedReaderTest(lines int) (string, []readerToken) {
+	input := strings.Repeat("let é = \"ü\"; // ✓ 𝕄\n", lines)
+
+	expected := []readerToken{}
+	for line := 1; line <= lines; line++ {
+		expected = append(expected,
+			readerToken{token.LET, "let", fmt.Sprintf("%d:1", line)},
+			readerToken{token.IDENT, "é", fmt.Sprintf("%d:5", line)},
+			readerToken{token.ASSIGN, "=", fmt.Sprintf("%d:7", line)},
+			readerToken{token.STRING, "ü", fmt.Sprintf("%d:9", line)},
+			readerToken{token.SEMICOLON, ";", fmt.Sprintf("%d:12", line)},
+			readerToken{token.COMMENT, "// ✓ 𝕄", fmt.Sprintf("%d:14", line)},
+		)
+	}
+	expected = append(expected, readerToken{token.EOF, "", fmt.Sprintf("%d:1", lines+1)})
+
+	return input, expected
+}
+
+func TestNewReader(t *testing.T) {
+	readers := map[string]func(string) io.Reader{
+		"whole":    func(s string) io.Reader { return strings.NewReader(s) },
+		"one byte": func(s string) io.Reader { return iotest.OneByteReader(strings.NewReader(s)) },
+		"half":     func(s string) io.Reader { return iotest.HalfReader(strings.NewReader(s)) },
+		"data err": func(s string) io.Reader { return iotest.DataErrReader(strings.NewReader(s)) },
+	}
+
+	tests := append([]readerTest{}, readerTests...)
+	input, expected := repeatedReaderTest(500)
+	tests = append(tests, readerTest{input, []Option{WithComments()}, expected, nil})
+
+	for _, tt := range tests {
+		for name, reader := range readers {
+			tokens, errs := lexAll(NewReader(reader(tt.input), tt.opts...))
+
+			if len(tokens) != len(tt.expectedTokens) {
+				t.Fatalf("%s reader, %q: wrong number of tokens. want=%d, got=%d",
+					name, tt.input, len(tt.expectedTokens), len(tokens))
+			}
+			for i, want := range tt.expectedTokens {
+				tok := tokens[i]
+				if tok.Type != want.expectedType || tok.Literal != want.expectedLiteral || tok.Pos.String() != want.expectedPos {
+					t.Fatalf("%s reader, %q: token %d wrong. want=%+v, got={%s %q %s}",
+						name, tt.input, i, want, tok.Type, tok.Literal, tok.Pos)
+				}
+			}
+			if strings.Join(errs, "\n") != strings.Join(tt.expectedErrors, "\n") {
+				t.Errorf("%s reader, %q: wrong errors.\nwant=%q\ngot =%q", name, tt.input, tt.expectedErrors, errs)
+			}
+		}
+	}
+}
+
+func TestNewReaderError(t *testing.T) {
+	input := io.MultiReader(strings.NewReader("let x = 1"), iotest.ErrReader(errors.New("broken pipe")))
+
+	tokens, errs := lexAll(NewReader(input))
+
+	types := []token.TokenType{}
+	for _, tok := range tokens {
+		types = append(types, tok.Type)
+	}
+	expected := []token.TokenType{token.LET, token.IDENT, token.ASSIGN, token.INT, token.EOF}
+	if fmt.Sprint(types) != fmt.Sprint(expected) {
+		t.Errorf("wrong tokens. want=%v, got=%v", expected, types)
+	}
+
+	if len(errs) != 1 || errs[0] != "1:10: read error: broken pipe" {
+		t.Errorf("wrong errors. got=%q", errs)
+	}
+}
+
+// pipeReader hands out its first chunk and then blocks until release is
+// closed, like a pipe whose writer hasn't sent the next line yet
+type pipeReader struct {
+	chunk   string
+	release chan struct{}
+}
+
+func (r *pipeReader) Read(p []byte) (int, error) {
+	if r.chunk != "" {
+		n := copy(p, r.chunk)
+		r.chunk = r.chunk[n:]
+		return n, nil
+	}
+	<-r.release
+	return 0, io.EOF
+}
+
+func TestNewReaderDoesNotWaitForMoreInput(t *testing.T) {
+	input := &pipeReader{chunk: "let x = 1;\n", release: make(chan struct{})}
+	tokens := make(chan token.Token)
+	go func() {
+		l := NewReader(input)
+		for {
+			tok := l.NextToken()
+			tokens <- tok
+			if tok.Type == token.EOF {
+				return
+			}
+		}
+	}()
+
+	expected := []token.TokenType{token.LET, token.IDENT, token.ASSIGN, token.INT, token.SEMICOLON}
+	for i, want := range expected {
+		select {
+		case tok := <-tokens:
+			if tok.Type != want {
+				t.Fatalf("tokens[%d] wrong. want=%q, got=%q", i, want, tok.Type)
+			}
+		case <-time.After(5 * time.Second):
+			close(input.release)
+			t.Fatalf("tokens[%d] %q held back until more input arrives", i, want)
+		}
+	}
+
+	select {
+	case tok := <-tokens:
+		t.Fatalf("got %q before the rest of the input arrived", tok.Type)
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	close(input.release)
+	if tok := <-tokens; tok.Type != token.EOF {
+		t.Errorf("wrong last token. want=%q, got=%q", token.EOF, tok.Type)
+	}
+}
+
+// lexAll reads tokens up to and including EOF
+func lexAll(l *Lexer) ([]token.Token, []string) {
+	tokens := []token.Token{}
+	for {
+		tok := l.NextToken()
+		tokens = append(tokens, tok)
+		if tok.Type == token.EOF {
+			break
+		}
+	}
+
+	errs := []string{}
+	for _, err := range l.Errors() {
+		errs = append(errs, err.Error())
+	}
+	return tokens, errs
 }
@@ -2,26 +2,61 @@ package main
 
 import (
 	"fmt"
-	"github.com/labstack/echo/v4"
-	// "os"
-	"os/user"
-	// "waiig/repl"
-	"waiig/web/webrepl"
+	"io"
+	"os"
 )
 
+const usage = `usage: waiig <command> [flags] [arguments]
+
+commands:
+  run file.mk ...   run a program, passing it the remaining arguments
+  repl              start an interactive session
+  serve             start the web REPL
+  tokens file.mk    print the tokens of a program, - reads it from stdin
+  ast file.mk       print a program as parsed
+  fmt file.mk       format a program
+
+Run waiig <command> -h for the flags of a command.
+`
+
+// exit codes, parse and runtime errors both count as errors
+const (
+	exitOK    = 0
+	exitError = 1
+	exitUsage = 2
+)
+
+type command func(args []string, stdin io.Reader, stdout, stderr io.Writer) int
+
+var commands = map[string]command{
+	"run":    runCmd,
+	"repl":   replCmd,
+	"serve":  serveCmd,
+	"tokens": tokensCmd,
+	"ast":    astCmd,
+	"fmt":    fmtCmd,
+}
+
 func main() {
-	u, err := user.Current()
-	if err != nil {
-		panic(err)
-	}
+	os.Exit(cli(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
 
-	fmt.Printf("Hello %s\n", u.Username)
-	server := echo.New()
+func cli(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return exitUsage
+	}
 
-	server.GET("/", webrepl.HandleIndex)
-	server.POST("/", webrepl.HandleEvaluate)
+	if args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		fmt.Fprint(stdout, usage)
+		return exitOK
+	}
 
-	server.Start(":8080")
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(stderr, "waiig: unknown command %q\n\n%s", args[0], usage)
+		return exitUsage
+	}
 
-	// repl.Start(os.Stdin, os.Stdout)
+	return cmd(args[1:], stdin, stdout, stderr)
 }
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"waiig/evaluator"
+	"waiig/object"
+	"waiig/token"
+	"waiig/web/webrepl"
+)
+
+func TestCli(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"ok.mk":        "let add = fn(a,b) { a+b };\nputs(add(1, 2));\n",
+		"parse.mk":     "let = 5;\n",
+		"runtime.mk":   "let x = 1;\nx + true;\n",
+		"script.mk":    "#!/usr/bin/env waiig run\nif (len(args) != 2) { exit(3) }\nlet code = if (args[0] == \"fail\") { 4 } else { 0 };\nexit(code);\nputs(\"not reached\");\n",
+		"noexit.mk":    "#!/usr/bin/env waiig run\nargs[0] + true\n",
+		"comment.mk":   "// answer\nlet x=42 /* the answer */\n",
+		"unbound.mk":   "let x = 1;\ny + x;\n",
+		"exitrange.mk": "exit(256)\n",
+		"trace.mk":     "let inc = fn(x) { x + 1 };\nlet loop = fn() { loop() };\nif (len(args) > 0) { loop() } else { inc(\"a\") }\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	path := func(name string) string { return filepath.Join(dir, name) }
+
+	tests := []struct {
+		args   []string
+		stdin  string
+		code   int
+		stdout string
+		stderr string // only checked to be contained in the output
+	}{
+		{[]string{}, "", exitUsage, "", "usage: waiig"},
+		{[]string{"frobnicate"}, "", exitUsage, "", `unknown command "frobnicate"`},
+		{[]string{"run"}, "", exitUsage, "", "usage: waiig run"},
+		{[]string{"run", "-engine", "jit", path("ok.mk")}, "", exitUsage, "", `unknown engine "jit"`},
+		{[]string{"run", path("missing.mk")}, "", exitError, "", "no such file"},
+		{[]string{"run", path("ok.mk")}, "", exitOK, "3\n", ""},
+		{[]string{"run", "-engine", "vm", path("ok.mk")}, "", exitOK, "3\n", ""},
+		{[]string{"run", path("parse.mk")}, "", exitError, "", "parse.mk:1:5: Expected IDENT, got =\nlet = 5;\n    ^\n"},
+		{[]string{"run", path("runtime.mk")}, "", exitError, "", "runtime.mk:2:3: type mismatch: INTEGER + BOOLEAN"},
+		{[]string{"run", "-engine", "vm", path("runtime.mk")}, "", exitError, "", "runtime.mk:2:3: type mismatch: INTEGER + BOOLEAN"},
+		{[]string{"run", "-engine", "vm", path("unbound.mk")}, "", exitError, "", "unbound.mk:2:1: identifier not found: y"},
+		{[]string{"run", "-engine", "vm", path("trace.mk")}, "", exitError, "", "trace.mk:1:21: type mismatch: STRING + INTEGER\n\tin inc called at 3:41\n"},
+		{[]string{"run", path("script.mk")}, "", 3, "", ""},
+		{[]string{"run", path("script.mk"), "fail", "-x"}, "", 4, "", ""},
+		{[]string{"run", path("script.mk"), "ok", "x"}, "", exitOK, "", ""},
+		{[]string{"run", "-engine", "vm", path("script.mk"), "fail", "x"}, "", 4, "", ""},
+		{[]string{"run", path("exitrange.mk")}, "", exitError, "", "exitrange.mk:1:5: exit code has to be between 0 and 255, got 256"},
+		{[]string{"run", "-engine", "vm", path("exitrange.mk")}, "", exitError, "", "exitrange.mk:1:5: exit code has to be between 0 and 255, got 256"},
+		{[]string{"run", path("noexit.mk"), "a"}, "", exitError, "", "noexit.mk:2:9: type mismatch: STRING + BOOLEAN"},
+		{[]string{"run", path("trace.mk")}, "", exitError, "", "trace.mk:1:21: type mismatch: STRING + INTEGER\n\tin inc called at 3:41\n"},
+		{[]string{"run", path("trace.mk"), "loop"}, "", exitError, "", "trace.mk:2:23: maximum recursion depth exceeded: 10000 nested calls\n\tin loop called at 2:23\n\t[previous call repeated 9998 more times]\n\tin loop called at 3:26\n"},
+		{[]string{"fmt", path("script.mk")}, "", exitOK, "#!/usr/bin/env waiig run\nif (len(args) != 2) {\n\texit(3);\n}\nlet code = if (args[0] == \"fail\") {\n\t4;\n} else {\n\t0;\n};\nexit(code);\nputs(\"not reached\");\n", ""},
+		{[]string{"repl"}, "1 + 1\n", exitOK, ">> 2\n>> ", ""},
+		{[]string{"repl", "-engine", "vm"}, "1 + 1\n", exitOK, ">> 2\n>> ", ""},
+		{[]string{"repl"}, "puts(1, \"a\")\n", exitOK, ">> 1\na\nnull\n>> ", ""},
+		{[]string{"tokens", path("parse.mk")}, "", exitOK, "1:1\tLET\t\"let\"\n1:5\t=\t\"=\"\n1:7\tINT\t\"5\"\n1:8\t;\t\";\"\n", ""},
+		{[]string{"ast", path("runtime.mk")}, "", exitOK, "let x = 1;(x + true)\n", ""},
+		{[]string{"ast", "-tree", path("runtime.mk")}, "", exitOK, "Program\n  LetStatement x\n    IntegerLiteral 1\n  ExpressionStatement\n    InfixExpression +\n      Identifier x\n      Boolean true\n", ""},
+		{[]string{"ast", path("parse.mk")}, "", exitError, "", "Expected IDENT"},
+		{[]string{"fmt", path("ok.mk")}, "", exitOK, "let add = fn(a, b) {\n\ta + b;\n};\nputs(add(1, 2));\n", ""},
+		{[]string{"fmt", path("comment.mk")}, "", exitOK, "// answer\nlet x = 42; /* the answer */\n", ""},
+		{[]string{"tokens", "-comments", path("comment.mk")}, "", exitOK, "1:1\tCOMMENT\t\"// answer\"\n2:1\tLET\t\"let\"\n2:5\tIDENT\t\"x\"\n2:6\t=\t\"=\"\n2:7\tINT\t\"42\"\n2:10\tCOMMENT\t\"/* the answer */\"\n", ""},
+		{[]string{"tokens", "-"}, "x >= 1 @", exitError, "1:1\tIDENT\t\"x\"\n1:3\t>=\t\">=\"\n1:6\tINT\t\"1\"\n1:8\tILLEGAL\t\"@\"\n", "-:1:8: illegal character '@'"},
+		{[]string{"fmt", "-x", path("ok.mk")}, "", exitUsage, "", "flag provided but not defined: -x"},
+	}
+
+	for _, tt := range tests {
+		var stdout, stderr bytes.Buffer
+		code := cli(tt.args, strings.NewReader(tt.stdin), &stdout, &stderr)
+
+		if code != tt.code {
+			t.Errorf("%v: wrong exit code. want=%d, got=%d (stderr %q)", tt.args, tt.code, code, stderr.String())
+		}
+		if stdout.String() != tt.stdout {
+			t.Errorf("%v: wrong output.\nwant=%q\ngot =%q", tt.args, tt.stdout, stdout.String())
+		}
+		if !strings.Contains(stderr.String(), tt.stderr) {
+			t.Errorf("%v: expected %q in errors, got=%q", tt.args, tt.stderr, stderr.String())
+		}
+	}
+}
+
+func TestExitIsOnlyBoundInScripts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "exit.mk")
+	if err := os.WriteFile(path, []byte("exit(2)"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	if code := cli([]string{"run", path}, nil, &stdout, &stderr); code != 2 {
+		t.Fatalf("wrong exit code. want=2, got=%d (%s)", code, stderr.String())
+	}
+
+	if object.GetBuiltinByName("exit") != nil {
+		t.Errorf("exit is registered as a builtin")
+	}
+	for _, engine := range []string{"eval", "vm"} {
+		stdout.Reset()
+		cli([]string{"repl", "-engine", engine}, strings.NewReader("exit(1)\n"), &stdout, &stderr)
+		if want := ">> ERROR: 1:1: identifier not found: exit\n>> "; stdout.String() != want {
+			t.Errorf("%s: wrong output. want=%q, got=%q", engine, want, stdout.String())
+		}
+	}
+}
+
+func TestFmtWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "messy.mk")
+	if err := os.WriteFile(path, []byte("let x=[1,2]  ;x[0]"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	if code := cli([]string{"fmt", "-w", path}, nil, &stdout, &stderr); code != exitOK {
+		t.Fatalf("fmt -w failed with %d: %s", code, stderr.String())
+	}
+
+	formatted, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(formatted) != "let x = [1, 2];\nx[0];\n" {
+		t.Errorf("wrong file content after fmt -w. got=%q", formatted)
+	}
+	if stdout.Len() != 0 {
+		t.Errorf("fmt -w shouldn't print the result, got=%q", stdout.String())
+	}
+}
+
+func TestServerBodyLimit(t *testing.T) {
+	h := webrepl.NewHandler(webrepl.NewStore(time.Minute, 10, 0), evaluator.Limits{})
+	server := newServer(h, "1K")
+
+	tests := []struct {
+		input string
+		code  int
+	}{
+		{"1 + 1", http.StatusOK},
+		{strings.Repeat("-", 2000) + "1", http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range tests {
+		form := url.Values{"in": {tt.input}}.Encode()
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+
+		server.ServeHTTP(rec, req)
+
+		if rec.Code != tt.code {
+			t.Errorf("wrong status for a %d byte body. want=%d, got=%d", len(form), tt.code, rec.Code)
+		}
+	}
+}
+
+func TestPrintError(t *testing.T) {
+	tests := []struct {
+		pos      token.Position
+		expected string
+	}{
+		{token.Position{Offset: 4, Line: 1, Column: 5}, "a.mk:1:5: evaluation canceled\n"},
+		{token.Position{}, "a.mk: evaluation canceled\n"},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		printError(&out, "a.mk", tt.pos, "evaluation canceled")
+		if out.String() != tt.expected {
+			t.Errorf("wrong error. want=%q, got=%q", tt.expected, out.String())
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package object
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Variadic is the Arity of a builtin that takes any number of arguments
+const Variadic = -1
+
+type BuiltinFunction func(args ...Object) Object
+
+// Builtin is a function implemented in Go and callable from Monkey code.
+// Arguments are checked against Arity and Types before Fn is called, so Fn
+// can use type assertions on its arguments without checking them again.
+// Returning nil from Fn stands for null.
+type Builtin struct {
+	Name  string
+	Arity int // exact number of arguments, or Variadic
+	// Types has the accepted types for each argument position, an empty entry
+	// (or a missing one) accepts anything. For variadic builtins the last
+	// entry applies to all the remaining arguments.
+	Types [][]ObjectType
+	Fn    BuiltinFunction
+}
+
+func (b *Builtin) Type() ObjectType { return BUILTIN_OBJ }
+func (b *Builtin) Inspect() string  { return "builtin function " + b.Name }
+
+// Call checks the arguments and calls Fn, an error object is returned when
+// the arguments don't match
+func (b *Builtin) Call(args ...Object) Object {
+	if b.Arity != Variadic && len(args) != b.Arity {
+		return NewError("wrong number of arguments to `%s`: got=%d, want=%d", b.Name, len(args), b.Arity)
+	}
+
+	for i, arg := range args {
+		accepted := b.acceptedTypes(i)
+		if len(accepted) == 0 || containsType(accepted, arg.Type()) {
+			continue
+		}
+		return NewError("argument %d to `%s` must be %s, got %s", i+1, b.Name, joinTypes(accepted), arg.Type())
+	}
+
+	return b.Fn(args...)
+}
+
+func (b *Builtin) acceptedTypes(i int) []ObjectType {
+	switch {
+	case i < len(b.Types):
+		return b.Types[i]
+	case b.Arity == Variadic && len(b.Types) > 0:
+		return b.Types[len(b.Types)-1]
+	default:
+		return nil
+	}
+}
+
+func containsType(types []ObjectType, t ObjectType) bool {
+	for _, candidate := range types {
+		if candidate == t {
+			return true
+		}
+	}
+	return false
+}
+
+func joinTypes(types []ObjectType) string {
+	names := make([]string, len(types))
+	for i, t := range types {
+		names[i] = string(t)
+	}
+	return strings.Join(names, " or ")
+}
+
+// NewError creates an error object, builtins should use it to report failures
+func NewError(format string, a ...interface{}) *Error {
+	return &Error{Message: fmt.Sprintf(format, a...)}
+}
+
+// The registry keeps builtins in registration order, since the position of a
+// builtin is how compiled code refers to it
+var (
+	builtinsMu sync.RWMutex
+	builtins   []*Builtin
+)
+
+// RegisterBuiltin makes b callable from Monkey code under b.Name. Registering
+// a name again replaces the previous builtin but keeps its position.
+func RegisterBuiltin(b *Builtin) {
+	builtinsMu.Lock()
+	defer builtinsMu.Unlock()
+
+	for i, existing := range builtins {
+		if existing.Name == b.Name {
+			builtins[i] = b
+			return
+		}
+	}
+	builtins = append(builtins, b)
+}
+
+// GetBuiltinByName returns nil if there's no builtin with that name
+func GetBuiltinByName(name string) *Builtin {
+	builtinsMu.RLock()
+	defer builtinsMu.RUnlock()
+
+	for _, b := range builtins {
+		if b.Name == name {
+			return b
+		}
+	}
+	return nil
+}
+
+// GetBuiltin returns the builtin at the given position of the registration
+// order, or nil if there's none. Unlike Builtins it doesn't copy the list, the
+// VM looks a builtin up every time it loads one
+func GetBuiltin(index int) *Builtin {
+	builtinsMu.RLock()
+	defer builtinsMu.RUnlock()
+
+	if index < 0 || index >= len(builtins) {
+		return nil
+	}
+	return builtins[index]
+}
+
+// Builtins returns the registered builtins in registration order
+func Builtins() []*Builtin {
+	builtinsMu.RLock()
+	defer builtinsMu.RUnlock()
+
+	return append([]*Builtin{}, builtins...)
+}
+
+func init() {
+	RegisterBuiltin(&Builtin{
+		Name:  "len",
+		Arity: 1,
+		Types: [][]ObjectType{{STRING_OBJ, ARRAY_OBJ, HASH_OBJ}},
+		Fn: func(args ...Object) Object {
+			switch arg := args[0].(type) {
+			case *String:
+				return &Integer{Value: int64(utf8.RuneCountInString(arg.Value))}
+			case *Array:
+				return &Integer{Value: int64(len(arg.Elements))}
+			default:
+				return &Integer{Value: int64(len(arg.(*Hash).Pairs))}
+			}
+		},
+	})
+
+	RegisterBuiltin(&Builtin{
+		Name:  "first",
+		Arity: 1,
+		Types: [][]ObjectType{{ARRAY_OBJ}},
+		Fn: func(args ...Object) Object {
+			elements := args[0].(*Array).Elements
+			if len(elements) == 0 {
+				return nil
+			}
+			return elements[0]
+		},
+	})
+
+	RegisterBuiltin(&Builtin{
+		Name:  "last",
+		Arity: 1,
+		Types: [][]ObjectType{{ARRAY_OBJ}},
+		Fn: func(args ...Object) Object {
+			elements := args[0].(*Array).Elements
+			if len(elements) == 0 {
+				return nil
+			}
+			return elements[len(elements)-1]
+		},
+	})
+
+	RegisterBuiltin(&Builtin{
+		Name:  "rest",
+		Arity: 1,
+		Types: [][]ObjectType{{ARRAY_OBJ}},
+		Fn: func(args ...Object) Object {
+			elements := args[0].(*Array).Elements
+			if len(elements) == 0 {
+				return nil
+			}
+			rest := make([]Object, len(elements)-1)
+			copy(rest, elements[1:])
+			return &Array{Elements: rest}
+		},
+	})
+
+	RegisterBuiltin(&Builtin{
+		Name:  "push",
+		Arity: 2,
+		Types: [][]ObjectType{{ARRAY_OBJ}},
+		Fn: func(args ...Object) Object {
+			elements := args[0].(*Array).Elements
+			pushed := make([]Object, len(elements)+1)
+			copy(pushed, elements)
+			pushed[len(elements)] = args[1]
+			return &Array{Elements: pushed}
+		},
+	})
+
+	RegisterBuiltin(NewPuts(os.Stdout))
+}
+
+// NewPuts returns a puts that prints to out. The registered one prints to
+// standard output, a session binds its own to send the output elsewhere
+func NewPuts(out io.Writer) *Builtin {
+	return &Builtin{
+		Name:  "puts",
+		Arity: Variadic,
+		Fn: func(args ...Object) Object {
+			// a value is written piece by piece, a writer that fails once
+			// it has enough doesn't have to wait for all of it
+			for _, arg := range args {
+				if WriteInspect(out, arg) != nil {
+					break
+				}
+				if _, err := io.WriteString(out, "\n"); err != nil {
+					break
+				}
+			}
+			return nil
+		},
+	}
+}
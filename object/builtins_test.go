@@ -0,0 +1,80 @@
+package object
+
+import "testing"
+
+func TestBuiltinCallChecksArguments(t *testing.T) {
+	b := &Builtin{
+		Name:  "join",
+		Arity: Variadic,
+		Types: [][]ObjectType{{ARRAY_OBJ}, {STRING_OBJ}},
+		Fn: func(args ...Object) Object {
+			return &Integer{Value: int64(len(args))}
+		},
+	}
+
+	tests := []struct {
+		args            []Object
+		expectedMessage string
+	}{
+		{[]Object{&Array{}}, ""},
+		{[]Object{&Array{}, &String{}, &String{}}, ""},
+		{[]Object{&String{}}, "argument 1 to `join` must be ARRAY, got STRING"},
+		{[]Object{&Array{}, &String{}, &Integer{}}, "argument 3 to `join` must be STRING, got INTEGER"},
+	}
+
+	for _, tt := range tests {
+		result := b.Call(tt.args...)
+
+		errObj, isErr := result.(*Error)
+		if tt.expectedMessage == "" {
+			if isErr {
+				t.Errorf("unexpected error: %s", errObj.Message)
+			}
+			continue
+		}
+		if !isErr {
+			t.Errorf("expected error %q, got=%T (%+v)", tt.expectedMessage, result, result)
+			continue
+		}
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q", tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func TestRegisterBuiltinReplacesInPlace(t *testing.T) {
+	before := Builtins()
+
+	index := -1
+	for i, b := range before {
+		if b.Name == "first" {
+			index = i
+		}
+	}
+	if index < 0 {
+		t.Fatalf("builtin `first` is not registered")
+	}
+
+	original := GetBuiltinByName("first")
+	defer RegisterBuiltin(original)
+
+	replacement := &Builtin{Name: "first", Arity: 0, Fn: func(args ...Object) Object { return nil }}
+	RegisterBuiltin(replacement)
+
+	after := Builtins()
+	if len(after) != len(before) {
+		t.Fatalf("registering an existing name changed the number of builtins. before=%d, after=%d", len(before), len(after))
+	}
+	if after[index] != replacement {
+		t.Errorf("replacement is not at the original position %d", index)
+	}
+	if GetBuiltinByName("first") != replacement {
+		t.Errorf("GetBuiltinByName didn't return the replacement")
+	}
+	if GetBuiltin(index) != replacement {
+		t.Errorf("GetBuiltin(%d) didn't return the replacement", index)
+	}
+	if GetBuiltin(-1) != nil || GetBuiltin(len(after)) != nil {
+		t.Errorf("GetBuiltin returned a builtin for a position out of range")
+	}
+}
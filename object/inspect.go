@@ -0,0 +1,112 @@
+package object
+
+import (
+	"errors"
+	"io"
+	"sort"
+	"strings"
+)
+
+// WriteInspect writes what Inspect returns for obj to w, one piece at a time,
+// and stops at the first write that fails. Arrays that hold the same array
+// several times take exponentially more bytes to print than to store, a
+// writer that fails once it has enough keeps printing them cheap
+func WriteInspect(w io.Writer, obj Object) error {
+	in := &inspector{w: w}
+	in.inspect(obj)
+	return in.err
+}
+
+// InspectN is Inspect cut off after max bytes, with "..." in place of the rest.
+// Use it for values from code that isn't trusted
+func InspectN(obj Object, max int) string {
+	out := &limitedBuilder{max: max}
+	if err := WriteInspect(out, obj); err != nil {
+		return out.String() + "..."
+	}
+	return out.String()
+}
+
+// inspector renders arrays and hashes element by element, so it can stop as
+// soon as the writer does
+type inspector struct {
+	w   io.Writer
+	err error
+}
+
+func (in *inspector) write(s string) {
+	if in.err == nil {
+		_, in.err = io.WriteString(in.w, s)
+	}
+}
+
+func (in *inspector) inspect(obj Object) {
+	if in.err != nil {
+		return
+	}
+
+	switch obj := obj.(type) {
+	case *Array:
+		in.write("[")
+		for i, e := range obj.Elements {
+			if i > 0 {
+				in.write(", ")
+			}
+			in.inspect(e)
+		}
+		in.write("]")
+
+	case *Hash:
+		// map iteration order is random, sorting keeps the output stable
+		pairs := make([]HashPair, 0, len(obj.Pairs))
+		keys := make(map[Object]string, len(obj.Pairs))
+		for _, pair := range obj.Pairs {
+			pairs = append(pairs, pair)
+			keys[pair.Key] = pair.Key.Inspect()
+		}
+		sort.Slice(pairs, func(i, j int) bool {
+			ki, kj := keys[pairs[i].Key], keys[pairs[j].Key]
+			if ki != kj {
+				return ki < kj
+			}
+			return pairs[i].Key.Type() < pairs[j].Key.Type()
+		})
+
+		in.write("{")
+		for i, pair := range pairs {
+			if i > 0 {
+				in.write(", ")
+			}
+			in.write(keys[pair.Key])
+			in.write(": ")
+			in.inspect(pair.Value)
+		}
+		in.write("}")
+
+	case *ReturnValue:
+		in.inspect(obj.Value)
+
+	default:
+		in.write(obj.Inspect())
+	}
+}
+
+var errFull = errors.New("output limit reached")
+
+// limitedBuilder keeps the first max bytes written to it
+type limitedBuilder struct {
+	buf strings.Builder
+	max int
+}
+
+func (b *limitedBuilder) Write(p []byte) (int, error) {
+	if room := b.max - b.buf.Len(); len(p) > room {
+		b.buf.Write(p[:room])
+		return room, errFull
+	}
+	return b.buf.Write(p)
+}
+
+func (b *limitedBuilder) String() string {
+	return b.buf.String()
+}
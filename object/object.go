@@ -0,0 +1,256 @@
+package object
+
+import (
+	"bytes"
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"waiig/ast"
+	"waiig/code"
+	"waiig/token"
+)
+
+type ObjectType string
+
+const (
+	INTEGER_OBJ      = "INTEGER"
+	FLOAT_OBJ        = "FLOAT"
+	BOOLEAN_OBJ      = "BOOLEAN"
+	NULL_OBJ         = "NULL"
+	RETURN_VALUE_OBJ = "RETURN_VALUE"
+	ERROR_OBJ        = "ERROR"
+	LIMIT_ERROR_OBJ  = "LIMIT_ERROR"
+	FUNCTION_OBJ     = "FUNCTION"
+	STRING_OBJ       = "STRING"
+	ARRAY_OBJ        = "ARRAY"
+	HASH_OBJ         = "HASH"
+	BUILTIN_OBJ      = "BUILTIN"
+
+	COMPILED_FUNCTION_OBJ = "COMPILED_FUNCTION"
+	CLOSURE_OBJ           = "CLOSURE"
+)
+
+type Object interface {
+	Type() ObjectType
+	Inspect() string
+}
+
+type Integer struct {
+	Value int64
+}
+
+func (i *Integer) Type() ObjectType { return INTEGER_OBJ }
+func (i *Integer) Inspect() string  { return fmt.Sprintf("%d", i.Value) }
+
+type Float struct {
+	Value float64
+}
+
+func (f *Float) Type() ObjectType { return FLOAT_OBJ }
+
+// Inspect keeps the ".0" of whole numbers so they don't look like integers
+func (f *Float) Inspect() string { return ast.FormatFloat(f.Value) }
+
+type Boolean struct {
+	Value bool
+}
+
+func (b *Boolean) Type() ObjectType { return BOOLEAN_OBJ }
+func (b *Boolean) Inspect() string  { return fmt.Sprintf("%t", b.Value) }
+
+type String struct {
+	Value string
+}
+
+func (s *String) Type() ObjectType { return STRING_OBJ }
+func (s *String) Inspect() string  { return s.Value }
+
+type Array struct {
+	Elements []Object
+}
+
+func (a *Array) Type() ObjectType { return ARRAY_OBJ }
+func (a *Array) Inspect() string {
+	var out strings.Builder
+	WriteInspect(&out, a)
+	return out.String()
+}
+
+// HashKey identifies a hash key by value, so that two different *String
+// objects with the same content find the same pair
+type HashKey struct {
+	Type  ObjectType
+	Value uint64
+}
+
+// Hashable is implemented by the objects that can be used as hash keys
+type Hashable interface {
+	HashKey() HashKey
+}
+
+func (i *Integer) HashKey() HashKey {
+	return HashKey{Type: i.Type(), Value: uint64(i.Value)}
+}
+
+func (b *Boolean) HashKey() HashKey {
+	var value uint64
+	if b.Value {
+		value = 1
+	}
+	return HashKey{Type: b.Type(), Value: value}
+}
+
+func (s *String) HashKey() HashKey {
+	h := fnv.New64a()
+	h.Write([]byte(s.Value))
+	return HashKey{Type: s.Type(), Value: h.Sum64()}
+}
+
+type HashPair struct {
+	Key   Object
+	Value Object
+}
+
+type Hash struct {
+	Pairs map[HashKey]HashPair
+}
+
+func (h *Hash) Type() ObjectType { return HASH_OBJ }
+func (h *Hash) Inspect() string {
+	var out strings.Builder
+	WriteInspect(&out, h)
+	return out.String()
+}
+
+type Null struct{}
+
+func (n *Null) Type() ObjectType { return NULL_OBJ }
+func (n *Null) Inspect() string  { return "null" }
+
+// ReturnValue wraps the value of a return statement so the evaluator can stop
+// evaluating the rest of the enclosing block and unwrap it at the top level
+type ReturnValue struct {
+	Value Object
+}
+
+func (rv *ReturnValue) Type() ObjectType { return RETURN_VALUE_OBJ }
+func (rv *ReturnValue) Inspect() string  { return rv.Value.Inspect() }
+
+type Error struct {
+	Message string
+	Pos     token.Position // where in the input the error happened
+	Stack   []Frame        // the calls in progress, innermost first
+}
+
+func (e *Error) Type() ObjectType { return ERROR_OBJ }
+func (e *Error) Inspect() string {
+	if e.Pos.IsValid() {
+		return fmt.Sprintf("ERROR: %s: %s", e.Pos, e.Message) + e.Trace()
+	}
+	return "ERROR: " + e.Message + e.Trace()
+}
+
+// Trace renders the stack one call per line, each line starting with a newline
+// so it can be appended to the message. It's empty outside of functions
+func (e *Error) Trace() string { return formatStack(e.Stack) }
+
+// LimitError stops an evaluation that went over one of the limits it was given.
+// It's kept apart from Error because the program itself may well be correct
+type LimitError struct {
+	Message string
+	Pos     token.Position // what was being evaluated when the limit was hit
+	Stack   []Frame        // the calls in progress, innermost first
+}
+
+func (e *LimitError) Type() ObjectType { return LIMIT_ERROR_OBJ }
+func (e *LimitError) Inspect() string {
+	if e.Pos.IsValid() {
+		return fmt.Sprintf("LIMIT EXCEEDED: %s: %s", e.Pos, e.Message) + e.Trace()
+	}
+	return "LIMIT EXCEEDED: " + e.Message + e.Trace()
+}
+
+func (e *LimitError) Trace() string { return formatStack(e.Stack) }
+
+// Frame is a call of a Monkey function
+type Frame struct {
+	Function string         // name of the function, or <anonymous>
+	Pos      token.Position // where it was called from
+}
+
+// formatStack collapses runs of the same frame, otherwise a runaway recursion
+// would print thousands of identical lines
+func formatStack(stack []Frame) string {
+	var out strings.Builder
+
+	for i := 0; i < len(stack); {
+		frame := stack[i]
+		fmt.Fprintf(&out, "\n\tin %s called at %s", frame.Function, frame.Pos)
+
+		repeated := 0
+		for i++; i < len(stack) && stack[i] == frame; i++ {
+			repeated++
+		}
+		if repeated > 0 {
+			fmt.Fprintf(&out, "\n\t[previous call repeated %d more times]", repeated)
+		}
+	}
+
+	return out.String()
+}
+
+// Function carries the environment it was defined in, which is what makes
+// closures possible
+type Function struct {
+	Name       string // name of the let binding the function literal was assigned to, if any
+	Parameters []*ast.Identifier
+	Body       *ast.BlockStatement
+	Env        *Environment
+}
+
+func (f *Function) Type() ObjectType { return FUNCTION_OBJ }
+func (f *Function) Inspect() string {
+	var out bytes.Buffer
+
+	params := []string{}
+	for _, p := range f.Parameters {
+		params = append(params, p.String())
+	}
+
+	out.WriteString("fn(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(") {\n")
+	out.WriteString(f.Body.String())
+	out.WriteString("\n}")
+
+	return out.String()
+}
+
+// CompiledFunction is the bytecode of a function literal, it's stored in the
+// constant pool and turned into a Closure at runtime
+type CompiledFunction struct {
+	Instructions  code.Instructions
+	NumLocals     int
+	NumParameters int
+	Name          string
+	// Positions maps the offset of an instruction to where in the input it
+	// was compiled from, so runtime errors can point at the source
+	Positions map[int]token.Position
+}
+
+func (cf *CompiledFunction) Type() ObjectType { return COMPILED_FUNCTION_OBJ }
+func (cf *CompiledFunction) Inspect() string {
+	return fmt.Sprintf("CompiledFunction[%p]", cf)
+}
+
+// Closure is what the VM calls, Free holds the values of the free variables
+// at the time the closure was created
+type Closure struct {
+	Fn   *CompiledFunction
+	Free []Object
+}
+
+func (c *Closure) Type() ObjectType { return CLOSURE_OBJ }
+func (c *Closure) Inspect() string {
+	return fmt.Sprintf("Closure[%p]", c)
+}
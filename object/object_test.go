@@ -0,0 +1,119 @@
+package object
+
+import "testing"
+
+func TestStringHashKey(t *testing.T) {
+	hello1 := &String{Value: "Hello World"}
+	hello2 := &String{Value: "Hello World"}
+	diff1 := &String{Value: "My name is johnny"}
+	diff2 := &String{Value: "My name is johnny"}
+
+	if hello1.HashKey() != hello2.HashKey() {
+		t.Errorf("strings with same content have different hash keys")
+	}
+
+	if diff1.HashKey() != diff2.HashKey() {
+		t.Errorf("strings with same content have different hash keys")
+	}
+
+	if hello1.HashKey() == diff1.HashKey() {
+		t.Errorf("strings with different content have same hash keys")
+	}
+}
+
+func TestHashKeyTypesDoNotCollide(t *testing.T) {
+	one := &Integer{Value: 1}
+	tru := &Boolean{Value: true}
+
+	if one.HashKey() == tru.HashKey() {
+		t.Errorf("integer 1 and true have the same hash key")
+	}
+}
+
+func TestHashInspectIsSorted(t *testing.T) {
+	hash := &Hash{Pairs: map[HashKey]HashPair{}}
+	for _, key := range []string{"c", "a", "b"} {
+		k := &String{Value: key}
+		hash.Pairs[k.HashKey()] = HashPair{Key: k, Value: &Integer{Value: 1}}
+	}
+
+	if hash.Inspect() != "{a: 1, b: 1, c: 1}" {
+		t.Errorf("hash.Inspect() wrong. got=%q", hash.Inspect())
+	}
+}
+
+func TestFloatInspect(t *testing.T) {
+	tests := []struct {
+		value    float64
+		expected string
+	}{
+		{1.5, "1.5"},
+		{2, "2.0"},
+		{-100000, "-100000.0"},
+		{1e21, "1e+21"},
+		{0.000001, "1e-06"},
+	}
+
+	for _, tt := range tests {
+		if got := (&Float{Value: tt.value}).Inspect(); got != tt.expected {
+			t.Errorf("wrong Inspect for %g. want=%q, got=%q", tt.value, tt.expected, got)
+		}
+	}
+}
+
+// doubled returns an array that holds the same array twice, n levels deep. It
+// takes n arrays in memory and 2^n ones when printed
+func doubled(n int) *Array {
+	a := &Array{Elements: []Object{&Integer{Value: 1}}}
+	for i := 0; i < n; i++ {
+		a = &Array{Elements: []Object{a, a}}
+	}
+	return a
+}
+
+func TestInspectN(t *testing.T) {
+	tests := []struct {
+		obj      Object
+		max      int
+		expected string
+	}{
+		{&Integer{Value: 12345}, 10, "12345"},
+		{&Integer{Value: 12345}, 3, "123..."},
+		{doubled(1), 100, "[[1], [1]]"},
+		{doubled(1), 5, "[[1],..."},
+		{doubled(60), 8, "[[[[[[[[..."},
+	}
+
+	for _, tt := range tests {
+		if got := InspectN(tt.obj, tt.max); got != tt.expected {
+			t.Errorf("wrong InspectN(%d). want=%q, got=%q", tt.max, tt.expected, got)
+		}
+	}
+}
+
+func TestFootprint(t *testing.T) {
+	one := &Integer{Value: 1}
+	env := NewEnvironment()
+	env.Set("s", &String{Value: "abcd"})
+	fn := &Function{Env: env}
+	env.Set("f", fn)
+
+	tests := []struct {
+		objs     []Object
+		expected int64
+	}{
+		{[]Object{one}, 8},
+		{[]Object{one, one}, 8},
+		{[]Object{&Array{Elements: []Object{one, one}}}, 24 + 2*16 + 8},
+		// each level holds the one below it twice, it's counted once
+		{[]Object{doubled(60)}, 61*(24+2*16) - 16 + 8},
+		// the function keeps its environment alive, which holds the function
+		{[]Object{fn}, 64 + 16 + 4},
+	}
+
+	for i, tt := range tests {
+		if got := Footprint(tt.objs...); got != tt.expected {
+			t.Errorf("tests[%d] - wrong footprint. want=%d, got=%d", i, tt.expected, got)
+		}
+	}
+}
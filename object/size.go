@@ -0,0 +1,77 @@
+package object
+
+// Size estimates the bytes a value takes, not counting the values it holds
+func Size(obj Object) int64 {
+	switch obj := obj.(type) {
+	case *Integer, *Float:
+		return 8
+	case *String:
+		return 16 + int64(len(obj.Value))
+	case *Array:
+		return 24 + 16*int64(len(obj.Elements))
+	case *Hash:
+		return 48 + 64*int64(len(obj.Pairs))
+	case *Function:
+		return 64
+	case *CompiledFunction:
+		return 64 + int64(len(obj.Instructions))
+	case *Closure:
+		return 32 + 16*int64(len(obj.Free))
+	default:
+		// booleans and null are shared
+		return 0
+	}
+}
+
+// Footprint estimates the bytes objs keep alive, everything they hold and the
+// environments of the functions among them included. A value reachable along
+// several paths is counted once, so an array holding the same array twice
+// costs what it takes in memory and not what it takes to print
+func Footprint(objs ...Object) int64 {
+	var total int64
+	seen := make(map[interface{}]bool)
+	stack := append([]Object(nil), objs...)
+	var envs []*Environment
+
+	for len(stack) > 0 || len(envs) > 0 {
+		if len(envs) > 0 {
+			env := envs[len(envs)-1]
+			envs = envs[:len(envs)-1]
+			if env == nil || seen[env] {
+				continue
+			}
+			seen[env] = true
+			for _, val := range env.store {
+				stack = append(stack, val)
+			}
+			envs = append(envs, env.outer)
+			continue
+		}
+
+		obj := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if obj == nil || seen[obj] {
+			continue
+		}
+		seen[obj] = true
+		total += Size(obj)
+
+		switch obj := obj.(type) {
+		case *Array:
+			stack = append(stack, obj.Elements...)
+		case *Hash:
+			for _, pair := range obj.Pairs {
+				stack = append(stack, pair.Key, pair.Value)
+			}
+		case *ReturnValue:
+			stack = append(stack, obj.Value)
+		case *Function:
+			envs = append(envs, obj.Env)
+		case *Closure:
+			stack = append(stack, obj.Fn)
+			stack = append(stack, obj.Free...)
+		}
+	}
+
+	return total
+}
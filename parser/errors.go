@@ -0,0 +1,68 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+	"waiig/token"
+)
+
+// ParseError is a problem found while parsing (or lexing) the input
+type ParseError struct {
+	Pos      token.Position
+	Expected token.TokenType // set when a specific token was expected
+	Got      token.TokenType // the token found at Pos
+	Message  string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Pos, e.Message)
+}
+
+// Diagnostic renders err together with the line of source it points at and a
+// caret under the offending column:
+//
+//	1:5: Expected IDENT, got =
+//	let = 5;
+//	    ^
+func Diagnostic(source string, err *ParseError) string {
+	var out strings.Builder
+
+	out.WriteString(err.Error())
+
+	if !err.Pos.IsValid() || err.Pos.Offset > len(source) {
+		return out.String()
+	}
+
+	lineStart := strings.LastIndexByte(source[:err.Pos.Offset], '\n') + 1
+	lineEnd := strings.IndexByte(source[err.Pos.Offset:], '\n')
+	if lineEnd < 0 {
+		lineEnd = len(source)
+	} else {
+		lineEnd += err.Pos.Offset
+	}
+
+	out.WriteString("\n")
+	out.WriteString(strings.TrimRight(source[lineStart:lineEnd], "\r"))
+	out.WriteString("\n")
+
+	// keep tabs so the caret lines up however wide the terminal renders them
+	for _, r := range source[lineStart:err.Pos.Offset] {
+		if r == '\t' {
+			out.WriteRune('\t')
+		} else {
+			out.WriteRune(' ')
+		}
+	}
+	out.WriteString("^")
+
+	return out.String()
+}
+
+// Diagnostics renders every error with Diagnostic, separated by blank lines
+func Diagnostics(source string, errs []*ParseError) string {
+	rendered := make([]string, len(errs))
+	for i, err := range errs {
+		rendered[i] = Diagnostic(source, err)
+	}
+	return strings.Join(rendered, "\n\n")
+}
@@ -0,0 +1,244 @@
+package parser
+
+import (
+	"testing"
+	"time"
+	"waiig/lexer"
+	"waiig/token"
+)
+
+func TestParseErrorFields(t *testing.T) {
+	input := "let x 5;"
+
+	p := New(lexer.New(input))
+	p.ParseProgram()
+
+	errors := p.Errors()
+	if len(errors) == 0 {
+		t.Fatalf("expected parser errors for %q", input)
+	}
+
+	err := errors[0]
+	if err.Expected != token.ASSIGN {
+		t.Errorf("err.Expected wrong. want=%q, got=%q", token.ASSIGN, err.Expected)
+	}
+	if err.Got != token.INT {
+		t.Errorf("err.Got wrong. want=%q, got=%q", token.INT, err.Got)
+	}
+	if err.Pos.String() != "1:7" {
+		t.Errorf("err.Pos wrong. want=1:7, got=%s", err.Pos)
+	}
+	if err.Message != "Expected =, got INT" {
+		t.Errorf("err.Message wrong. got=%q", err.Message)
+	}
+}
+
+func TestErrorsAreOrderedByPosition(t *testing.T) {
+	input := `let x 5; "abc`
+
+	p := New(lexer.New(input))
+	p.ParseProgram()
+
+	errors := p.Errors()
+	for i := 1; i < len(errors); i++ {
+		if errors[i-1].Pos.Offset > errors[i].Pos.Offset {
+			t.Errorf("errors not ordered by position: %q before %q", errors[i-1].Error(), errors[i].Error())
+		}
+	}
+	if last := errors[len(errors)-1]; last.Got != token.ILLEGAL {
+		t.Errorf("lexer error not reported as ILLEGAL. got=%q", last.Got)
+	}
+}
+
+func TestDiagnostic(t *testing.T) {
+	tests := []struct {
+		source   string
+		err      *ParseError
+		expected string
+	}{
+		{
+			"let = 5;",
+			&ParseError{Pos: token.Position{Offset: 4, Line: 1, Column: 5}, Message: "Expected IDENT, got ="},
+			"1:5: Expected IDENT, got =\nlet = 5;\n    ^",
+		},
+		{
+			"let a = 1;\n\tlet b = );\nlet c = 3;",
+			&ParseError{Pos: token.Position{Offset: 20, Line: 2, Column: 10}, Message: "No prefix parse function for )"},
+			"2:10: No prefix parse function for )\n\tlet b = );\n\t        ^",
+		},
+		{
+			"add(1,",
+			&ParseError{Pos: token.Position{Offset: 6, Line: 1, Column: 7}, Message: "Expected ), got EOF"},
+			"1:7: Expected ), got EOF\nadd(1,\n      ^",
+		},
+		{
+			"let café = ;",
+			&ParseError{Pos: token.Position{Offset: 12, Line: 1, Column: 12}, Message: "No prefix parse function for ;"},
+			"1:12: No prefix parse function for ;\nlet café = ;\n           ^",
+		},
+		{
+			"x",
+			&ParseError{Message: "no position"},
+			"-: no position",
+		},
+	}
+
+	for _, tt := range tests {
+		actual := Diagnostic(tt.source, tt.err)
+		if actual != tt.expected {
+			t.Errorf("wrong diagnostic.\nwant=%q\ngot= %q", tt.expected, actual)
+		}
+	}
+}
+
+func TestErrorRecovery(t *testing.T) {
+	tests := []struct {
+		input              string
+		expectedErrors     []string
+		expectedStatements string
+	}{
+		{
+			"let = 5; let y 10; let z = 1;",
+			[]string{"1:5: Expected IDENT, got =", "1:16: Expected =, got INT"},
+			"let z = 1;",
+		},
+		{
+			"let x = (1 + ; x",
+			[]string{"1:14: No prefix parse function for ;"},
+			"x",
+		},
+		{
+			"let a = 1\nlet b = )\nreturn a",
+			[]string{"2:9: No prefix parse function for )"},
+			"let a = 1;return a;",
+		},
+		{
+			"let f = fn(x) { let = 1; x * 2 }; f(1)",
+			[]string{"1:21: Expected IDENT, got ="},
+			"let f = fn(x) (x * 2);f(1)",
+		},
+		{
+			"let s = \"abc; let t = 1",
+			[]string{"1:9: unterminated string literal"},
+			"",
+		},
+		{
+			"let a = @ 1; a",
+			[]string{"1:9: illegal character '@'"},
+			"a",
+		},
+		{
+			"if (x { y }",
+			[]string{"1:7: Expected ), got {"},
+			"",
+		},
+		{
+			"let f = fn() { 1 + }\n}\nlet x = 1",
+			[]string{"1:20: No prefix parse function for }", "2:1: No prefix parse function for }"},
+			"let f = fn() ;let x = 1;",
+		},
+		{
+			"let f = fn(x) { if (x) { x + } else { 2 }; 3 }; f(1)",
+			[]string{"1:30: No prefix parse function for }"},
+			"let f = fn(x) ifx else 23;f(1)",
+		},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != len(tt.expectedErrors) {
+			t.Errorf("wrong number of errors for %q. want=%d, got=%d", tt.input, len(tt.expectedErrors), len(errors))
+			for _, e := range errors {
+				t.Errorf("parser error: %q", e.Error())
+			}
+			continue
+		}
+		for i, msg := range tt.expectedErrors {
+			if errors[i].Error() != msg {
+				t.Errorf("errors[%d] wrong for %q. want=%q, got=%q", i, tt.input, msg, errors[i].Error())
+			}
+		}
+
+		if program.String() != tt.expectedStatements {
+			t.Errorf("wrong statements for %q. want=%q, got=%q", tt.input, tt.expectedStatements, program.String())
+		}
+	}
+}
+
+func TestErrorRecoveryTerminates(t *testing.T) {
+	inputs := []string{
+		"let",
+		"let x",
+		"let x =",
+		"return",
+		"fn(",
+		"fn(x, ",
+		"{",
+		"{\"a\": ",
+		"[1, 2",
+		"if (",
+		"}}}",
+		"a[",
+	}
+
+	for _, input := range inputs {
+		done := make(chan bool)
+		go func() {
+			p := New(lexer.New(input))
+			p.ParseProgram()
+			done <- len(p.Errors()) > 0
+		}()
+
+		select {
+		case hasErrors := <-done:
+			if !hasErrors {
+				t.Errorf("no errors reported for %q", input)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("parsing %q didn't terminate", input)
+		}
+	}
+}
+
+func TestEmptyStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{";;;", ""},
+		{"1;; 2", "12"},
+		{"let f = fn() { ; };; f()", "let f = fn() ;f()"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+
+		if len(p.Errors()) != 0 {
+			t.Errorf("errors for %q: %q", tt.input, p.Errors())
+		}
+		if program.String() != tt.expected {
+			t.Errorf("wrong statements for %q. want=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+}
+
+func TestUnicodeErrorPositions(t *testing.T) {
+	input := `let größe = "☕" +;`
+
+	p := New(lexer.New(input))
+	p.ParseProgram()
+
+	errs := p.Errors()
+	if len(errs) != 1 {
+		t.Fatalf("expected 1 error, got=%v", errs)
+	}
+
+	expected := "1:18: No prefix parse function for ;\n" + input + "\n                 ^"
+	if Diagnostic(input, errs[0]) != expected {
+		t.Errorf("wrong diagnostic.\nwant=%q\ngot= %q", expected, Diagnostic(input, errs[0]))
+	}
+}
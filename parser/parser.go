@@ -1,8 +1,11 @@
 package parser
 
 import (
+	"errors"
 	"fmt"
+	"sort"
 	"strconv"
+	"strings"
 	"waiig/ast"
 	"waiig/lexer"
 	"waiig/token"
@@ -11,25 +14,46 @@ import (
 const (
 	_ int = iota
 	LOWEST
+	OR          // ||
+	AND         // &&
 	EQUALS      // ==
 	LESSGREATER // > or <
-	SUM         //+
-	PRODUCT     //*
+	SHIFT       // << or >>
+	SUM         //+ | ^
+	PRODUCT     //* &
 	PREFIX      //-Xor!X
 	CALL        // myFunction(X)
+	INDEX       // array[index]
 )
 
 var precedences = map[token.TokenType]int{
-	token.EQ:       EQUALS,
-	token.NOT_EQ:   EQUALS,
-	token.LT:       LESSGREATER,
-	token.GT:       LESSGREATER,
-	token.PLUS:     SUM,
-	token.MINUS:    SUM,
-	token.SLASH:    PRODUCT,
-	token.ASTERISK: PRODUCT,
+	token.OR:          OR,
+	token.AND:         AND,
+	token.EQ:          EQUALS,
+	token.NOT_EQ:      EQUALS,
+	token.LT:          LESSGREATER,
+	token.GT:          LESSGREATER,
+	token.LT_EQ:       LESSGREATER,
+	token.GT_EQ:       LESSGREATER,
+	token.SHIFT_LEFT:  SHIFT,
+	token.SHIFT_RIGHT: SHIFT,
+	token.PLUS:        SUM,
+	token.MINUS:       SUM,
+	token.PIPE:        SUM,
+	token.CARET:       SUM,
+	token.SLASH:       PRODUCT,
+	token.ASTERISK:    PRODUCT,
+	token.PERCENT:     PRODUCT,
+	token.AMPERSAND:   PRODUCT,
+	token.LPAREN:      CALL,
+	token.LBRACKET:    INDEX,
 }
 
+// maxNesting bounds how deeply expressions may nest. The parser recurses once
+// per level and so does everything that walks the tree, past this a hostile
+// input could overflow the Go stack, which can't be recovered from
+const maxNesting = 10000
+
 type prefixParseFn func() ast.Expression
 type infixParseFn func(ast.Expression) ast.Expression // Receives a 'left side' expression as a parameter
 
@@ -37,7 +61,12 @@ type Parser struct {
 	lex            *lexer.Lexer
 	currToken      token.Token
 	peekToken      token.Token
-	errors         []string
+	currDoc        []token.Token // /// comments right above currToken
+	peekDoc        []token.Token
+	comments       []*ast.Comment
+	errors         []*ParseError
+	panicking      bool // an error was reported and we haven't synchronized yet
+	depth          int  // expressions being parsed inside each other
 	prefixParseFns map[token.TokenType]prefixParseFn
 	infixParseFns  map[token.TokenType]infixParseFn
 }
@@ -54,16 +83,34 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerInfix(token.GT, p.parseInfixExpression)
 	p.registerInfix(token.SLASH, p.parseInfixExpression)
 	p.registerInfix(token.ASTERISK, p.parseInfixExpression)
+	p.registerInfix(token.PERCENT, p.parseInfixExpression)
+	p.registerInfix(token.LT_EQ, p.parseInfixExpression)
+	p.registerInfix(token.GT_EQ, p.parseInfixExpression)
+	p.registerInfix(token.AND, p.parseInfixExpression)
+	p.registerInfix(token.OR, p.parseInfixExpression)
+	p.registerInfix(token.AMPERSAND, p.parseInfixExpression)
+	p.registerInfix(token.PIPE, p.parseInfixExpression)
+	p.registerInfix(token.CARET, p.parseInfixExpression)
+	p.registerInfix(token.SHIFT_LEFT, p.parseInfixExpression)
+	p.registerInfix(token.SHIFT_RIGHT, p.parseInfixExpression)
+	p.registerInfix(token.LPAREN, p.parseCallExpression)
+	p.registerInfix(token.LBRACKET, p.parseIndexExpression)
 
 	p.prefixParseFns = make(map[token.TokenType]prefixParseFn)
 	p.registerPrefix(token.IDENT, p.parseIdentifier)
 	p.registerPrefix(token.INT, p.parseIntegerLiteral)
+	p.registerPrefix(token.FLOAT, p.parseFloatLiteral)
+	p.registerPrefix(token.STRING, p.parseStringLiteral)
+	p.registerPrefix(token.ILLEGAL, p.parseIllegal)
 	p.registerPrefix(token.BANG, p.parsePrefixExpression)
 	p.registerPrefix(token.MINUS, p.parsePrefixExpression)
 	p.registerPrefix(token.TRUE, p.parseBoolean)
 	p.registerPrefix(token.FALSE, p.parseBoolean)
 	p.registerPrefix(token.LPAREN, p.parseGroupExpression)
 	p.registerPrefix(token.IF, p.parseIfExpression)
+	p.registerPrefix(token.FUNCTION, p.parseFunctionLiteral)
+	p.registerPrefix(token.LBRACKET, p.parseArrayLiteral)
+	p.registerPrefix(token.LBRACE, p.parseHashLiteral)
 
 	p.NextToken()
 	p.NextToken()
@@ -71,9 +118,52 @@ func New(l *lexer.Lexer) *Parser {
 	return p
 }
 
+// NextToken advances by one token. Comments, which the lexer only produces
+// when asked to, are collected for the program instead of parsed
 func (p *Parser) NextToken() {
 	p.currToken = p.peekToken
+	p.currDoc = p.peekDoc
+	p.peekDoc = nil
+
 	p.peekToken = p.lex.NextToken()
+	for p.peekToken.Type == token.COMMENT {
+		p.comments = append(p.comments, &ast.Comment{Token: p.peekToken})
+		p.collectDoc(p.peekToken)
+		p.peekToken = p.lex.NextToken()
+	}
+}
+
+// collectDoc keeps track of the /// comments on consecutive lines before the
+// next token, any other comment or a gap between the lines starts over
+func (p *Parser) collectDoc(comment token.Token) {
+	if !isDocComment(comment.Literal) {
+		p.peekDoc = nil
+		return
+	}
+	if n := len(p.peekDoc); n > 0 && p.peekDoc[n-1].Pos.Line+1 != comment.Pos.Line {
+		p.peekDoc = nil
+	}
+	p.peekDoc = append(p.peekDoc, comment)
+}
+
+func isDocComment(literal string) bool {
+	return strings.HasPrefix(literal, "///") && !strings.HasPrefix(literal, "////")
+}
+
+// docText returns the text of the doc comments right above the current token,
+// without the slashes and one space after them
+func (p *Parser) docText() string {
+	n := len(p.currDoc)
+	if n == 0 || p.currDoc[n-1].Pos.Line+1 != p.currToken.Pos.Line {
+		return ""
+	}
+
+	lines := []string{}
+	for _, c := range p.currDoc {
+		text := strings.TrimPrefix(c.Literal, "///")
+		lines = append(lines, strings.TrimPrefix(text, " "))
+	}
+	return strings.Join(lines, "\n")
 }
 
 func (p *Parser) ParseProgram() *ast.Program {
@@ -82,17 +172,71 @@ func (p *Parser) ParseProgram() *ast.Program {
 
 	for p.currToken.Type != token.EOF {
 		s := p.parseStatement()
-		if s != nil {
+		if p.panicking {
+			// there's no block to close at the top level, a stray '}' has
+			// been reported already and is skipped
+			p.synchronize()
+		} else if s != nil {
 			program.Statements = append(program.Statements, s)
 		}
 		p.NextToken()
 	}
+	program.Comments = p.comments
 
 	return program
 }
 
-func (p *Parser) Errors() []string {
-	return p.errors
+// synchronize skips the rest of a statement that failed to parse, so that a
+// single mistake is reported once instead of cascading into the statements
+// after it. It stops on the last token of the broken statement: a ';' or '}',
+// or the token before a '}', 'let', 'return' or the end of the input. Blocks
+// opened inside the broken statement are skipped as a whole. A '}' the
+// statement didn't open isn't part of it, when the error is at such a brace
+// synchronize returns true and stays on it so the block parser can close the
+// block with it.
+func (p *Parser) synchronize() bool {
+	p.panicking = false
+
+	depth := 0
+	for p.currToken.Type != token.EOF {
+		switch p.currToken.Type {
+		case token.LBRACE:
+			depth++
+		case token.RBRACE:
+			if depth == 0 {
+				return true
+			}
+			depth--
+		case token.SEMICOLON:
+			if depth == 0 {
+				return false
+			}
+		}
+
+		if depth == 0 {
+			switch p.peekToken.Type {
+			case token.RBRACE, token.LET, token.RETURN, token.EOF:
+				return false
+			}
+		}
+
+		p.NextToken()
+	}
+	return false
+}
+
+func (p *Parser) Errors() []*ParseError {
+	errors := []*ParseError{}
+	for _, e := range p.lex.Errors() {
+		errors = append(errors, &ParseError{Pos: e.Pos, Got: token.ILLEGAL, Message: e.Message})
+	}
+	errors = append(errors, p.errors...)
+
+	sort.SliceStable(errors, func(i, j int) bool {
+		return errors[i].Pos.Offset < errors[j].Pos.Offset
+	})
+
+	return errors
 }
 
 func (p *Parser) parseStatement() ast.Statement {
@@ -101,6 +245,9 @@ func (p *Parser) parseStatement() ast.Statement {
 		return p.parseLetStatement()
 	case token.RETURN:
 		return p.parseReturnStatement()
+	case token.SEMICOLON:
+		// an empty statement, there's nothing to parse
+		return nil
 	default:
 		return p.parseExpressionStatement()
 	}
@@ -112,7 +259,7 @@ func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 	es.Expression = p.parseExpression(LOWEST)
 
 	// We allow things like 5 + 5 - no semicolon needed
-	if p.peekToken.Literal == token.SEMICOLON {
+	if p.peekToken.Type == token.SEMICOLON {
 		p.NextToken()
 	}
 
@@ -122,8 +269,11 @@ func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	rs := &ast.ReturnStatement{Token: p.currToken}
 
-	// TODO: skipping until semicolon
-	for p.currToken.Type != token.SEMICOLON {
+	p.NextToken()
+
+	rs.Value = p.parseExpression(LOWEST)
+
+	if p.peekToken.Type == token.SEMICOLON {
 		p.NextToken()
 	}
 
@@ -131,7 +281,7 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 }
 
 func (p *Parser) parseLetStatement() *ast.LetStatement {
-	ls := &ast.LetStatement{Token: p.currToken}
+	ls := &ast.LetStatement{Token: p.currToken, Doc: p.docText()}
 
 	if !p.expectPeek(token.IDENT) {
 		return nil
@@ -146,8 +296,15 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 		return nil
 	}
 
-	// TODO: skipping until semicolon
-	for p.currToken.Type != token.SEMICOLON {
+	p.NextToken()
+
+	ls.Value = p.parseExpression(LOWEST)
+
+	if fl, ok := ls.Value.(*ast.FunctionLiteral); ok {
+		fl.Name = ls.Name.Value
+	}
+
+	if p.peekToken.Type == token.SEMICOLON {
 		p.NextToken()
 	}
 
@@ -155,6 +312,17 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 }
 
 func (p *Parser) parseExpression(precedence int) ast.Expression {
+	p.depth++
+	defer func() { p.depth-- }()
+	if p.depth > maxNesting {
+		p.addError(&ParseError{
+			Pos:     p.currToken.Pos,
+			Got:     p.currToken.Type,
+			Message: fmt.Sprintf("Expression nested too deeply, more than %d levels", maxNesting),
+		})
+		return nil
+	}
+
 	prefix := p.prefixParseFns[p.currToken.Type]
 	if prefix == nil {
 		p.noPrefixParseFnError(p.currToken.Type)
@@ -162,7 +330,7 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 	}
 	leftExp := prefix()
 
-	for p.peekToken.Literal != token.SEMICOLON && precedence < p.peekPrecedence() {
+	for p.peekToken.Type != token.SEMICOLON && precedence < p.peekPrecedence() {
 		infix := p.infixParseFns[p.peekToken.Type]
 		if infix == nil {
 			return leftExp
@@ -183,9 +351,49 @@ func (p *Parser) parseIdentifier() ast.Expression {
 func (p *Parser) parseIntegerLiteral() ast.Expression {
 	lit := &ast.IntegerLiteral{Token: p.currToken}
 
-	value, err := strconv.ParseInt(p.currToken.Literal, 0, 64)
+	// the lexer checked the digits and underscores, only the range can be off
+	digits, base := integerBase(strings.ReplaceAll(p.currToken.Literal, "_", ""))
+	value, err := strconv.ParseInt(digits, base, 64)
+	if err != nil {
+		message := fmt.Sprintf("Could not parse %q as integer", p.currToken.Literal)
+		if errors.Is(err, strconv.ErrRange) {
+			message = fmt.Sprintf("Integer literal %s out of range", p.currToken.Literal)
+		}
+		p.addError(&ParseError{Pos: p.currToken.Pos, Got: p.currToken.Type, Message: message})
+		return nil
+	}
+
+	lit.Value = value
+
+	return lit
+}
+
+// integerBase splits the base prefix off an integer literal, a literal without
+// one is decimal even if it starts with 0
+func integerBase(literal string) (string, int) {
+	if len(literal) > 2 && literal[0] == '0' {
+		switch literal[1] {
+		case 'x', 'X':
+			return literal[2:], 16
+		case 'o', 'O':
+			return literal[2:], 8
+		case 'b', 'B':
+			return literal[2:], 2
+		}
+	}
+	return literal, 10
+}
+
+func (p *Parser) parseFloatLiteral() ast.Expression {
+	lit := &ast.FloatLiteral{Token: p.currToken}
+
+	value, err := strconv.ParseFloat(strings.ReplaceAll(p.currToken.Literal, "_", ""), 64)
 	if err != nil {
-		p.errors = append(p.errors, "Could not parse %q as integer", p.currToken.Literal)
+		message := fmt.Sprintf("Could not parse %q as float", p.currToken.Literal)
+		if errors.Is(err, strconv.ErrRange) {
+			message = fmt.Sprintf("Float literal %s out of range", p.currToken.Literal)
+		}
+		p.addError(&ParseError{Pos: p.currToken.Pos, Got: p.currToken.Type, Message: message})
 		return nil
 	}
 
@@ -194,6 +402,17 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 	return lit
 }
 
+func (p *Parser) parseStringLiteral() ast.Expression {
+	return &ast.StringLiteral{Token: p.currToken, Value: p.currToken.Literal}
+}
+
+// parseIllegal doesn't report anything, the lexer already did when it
+// produced the ILLEGAL token, but the statement is still broken
+func (p *Parser) parseIllegal() ast.Expression {
+	p.panicking = true
+	return nil
+}
+
 func (p *Parser) parsePrefixExpression() ast.Expression {
 	exp := &ast.PrefixExpression{
 		Token:    p.currToken,
@@ -253,6 +472,15 @@ func (p *Parser) currPrecedence() int {
 	return LOWEST
 }
 
+// Precedence tells how tightly an infix operator binds, it's LOWEST for tokens
+// that aren't infix operators
+func Precedence(t token.TokenType) int {
+	if p, ok := precedences[t]; ok {
+		return p
+	}
+	return LOWEST
+}
+
 func (p *Parser) expectPeek(t token.TokenType) bool {
 	if p.peekToken.Type != t {
 		p.peekError(t)
@@ -272,11 +500,30 @@ func (p *Parser) registerInfix(t token.TokenType, ifn infixParseFn) {
 }
 
 func (p *Parser) peekError(t token.TokenType) {
-	p.errors = append(p.errors, fmt.Sprintf("Expected %s, got %s", t, p.peekToken.Type))
+	p.addError(&ParseError{
+		Pos:      p.peekToken.Pos,
+		Expected: t,
+		Got:      p.peekToken.Type,
+		Message:  fmt.Sprintf("Expected %s, got %s", t, p.peekToken.Type),
+	})
+}
+
+// addError records err unless an earlier error in the same statement was
+// already reported, what follows the first error is most likely noise
+func (p *Parser) addError(err *ParseError) {
+	if p.panicking {
+		return
+	}
+	p.panicking = true
+	p.errors = append(p.errors, err)
 }
 
 func (p *Parser) noPrefixParseFnError(tt token.TokenType) {
-	p.errors = append(p.errors, fmt.Sprintf("No prefix parse function for %s", tt))
+	p.addError(&ParseError{
+		Pos:     p.currToken.Pos,
+		Got:     tt,
+		Message: fmt.Sprintf("No prefix parse function for %s", tt),
+	})
 }
 
 func (p *Parser) parseIfExpression() ast.Expression {
@@ -320,10 +567,143 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 
 	for p.currToken.Type != token.RBRACE && p.currToken.Type != token.EOF {
 		stmt := p.parseStatement()
-		if stmt != nil {
+		if p.panicking {
+			if p.synchronize() {
+				continue
+			}
+		} else if stmt != nil {
 			block.Statements = append(block.Statements, stmt)
 		}
 		p.NextToken()
 	}
+	block.End = p.currToken.Pos
 	return block
 }
+
+func (p *Parser) parseFunctionLiteral() ast.Expression {
+	lit := &ast.FunctionLiteral{Token: p.currToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	lit.Parameters = p.parseFunctionParameters()
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	lit.Body = p.parseBlockStatement()
+
+	return lit
+}
+
+func (p *Parser) parseFunctionParameters() []*ast.Identifier {
+	identifiers := []*ast.Identifier{}
+
+	if p.peekToken.Type == token.RPAREN {
+		p.NextToken()
+		return identifiers
+	}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	identifiers = append(identifiers, &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal})
+
+	for p.peekToken.Type == token.COMMA {
+		p.NextToken()
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		identifiers = append(identifiers, &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal})
+	}
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	return identifiers
+}
+
+func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
+	exp := &ast.CallExpression{Token: p.currToken, Function: function}
+	exp.Arguments = p.parseExpressionList(token.RPAREN)
+	return exp
+}
+
+func (p *Parser) parseArrayLiteral() ast.Expression {
+	array := &ast.ArrayLiteral{Token: p.currToken}
+	array.Elements = p.parseExpressionList(token.RBRACKET)
+	return array
+}
+
+// parseExpressionList parses comma separated expressions up to the end token,
+// it's shared by call arguments and array literals
+func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
+	list := []ast.Expression{}
+
+	if p.peekToken.Type == end {
+		p.NextToken()
+		return list
+	}
+
+	p.NextToken()
+	list = append(list, p.parseExpression(LOWEST))
+
+	for p.peekToken.Type == token.COMMA {
+		p.NextToken()
+		p.NextToken()
+		list = append(list, p.parseExpression(LOWEST))
+	}
+
+	if !p.expectPeek(end) {
+		return nil
+	}
+
+	return list
+}
+
+func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
+	exp := &ast.IndexExpression{Token: p.currToken, Left: left}
+
+	p.NextToken()
+	exp.Index = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RBRACKET) {
+		return nil
+	}
+
+	return exp
+}
+
+func (p *Parser) parseHashLiteral() ast.Expression {
+	hash := &ast.HashLiteral{Token: p.currToken}
+	hash.Keys = []ast.Expression{}
+	hash.Values = []ast.Expression{}
+
+	for p.peekToken.Type != token.RBRACE {
+		p.NextToken()
+		key := p.parseExpression(LOWEST)
+
+		if !p.expectPeek(token.COLON) {
+			return nil
+		}
+
+		p.NextToken()
+		value := p.parseExpression(LOWEST)
+
+		hash.Keys = append(hash.Keys, key)
+		hash.Values = append(hash.Values, value)
+
+		if p.peekToken.Type != token.RBRACE && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+
+	return hash
+}
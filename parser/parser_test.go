@@ -2,6 +2,7 @@ package parser
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 	"waiig/ast"
 	"waiig/lexer"
@@ -9,80 +10,91 @@ import (
 )
 
 func TestLetStatement(t *testing.T) {
-	input := `
-		let x = 5;
-		let y = 10;
-		let foobar = 838383;
-		`
+	tests := []struct {
+		input              string
+		expectedIdentifier string
+		expectedValue      interface{}
+	}{
+		{"let x = 5;", "x", 5},
+		{"let y = true;", "y", true},
+		{"let foobar = y;", "foobar", "y"},
+		{"let z = 10", "z", 10},
+	}
 
-	l := lexer.New(input)
-	p := New(l)
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
 
-	program := p.ParseProgram()
-	checkParserErrors(t, p)
-	if program == nil {
-		t.Fatalf("ParseProgram() returned nil")
-	}
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statement. got=%d",
+				len(program.Statements))
+		}
 
-	if len(program.Statements) != 3 {
-		t.Fatalf("program.Statements does not contain 3 statements. got=%d",
-			len(program.Statements))
+		s := program.Statements[0]
+		if !testLetStatement(t, s, tt.expectedIdentifier) {
+			return
+		}
+
+		val := s.(*ast.LetStatement).Value
+		if !testLiteralExpression(t, val, tt.expectedValue) {
+			return
+		}
 	}
+}
 
-	tests := []struct{ expectedIdentifier string }{
-		{expectedIdentifier: "x"},
-		{expectedIdentifier: "y"},
-		{expectedIdentifier: "foobar"},
+func TestReturnStatement(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedValue interface{}
+	}{
+		{"return 5;", 5},
+		{"return true;", true},
+		{"return foobar;", "foobar"},
+		{"return x", "x"},
 	}
 
-	for i, tt := range tests {
-		s := program.Statements[i]
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
 
-		if s.TokenLiteral() != "let" {
-			t.Errorf("letStmt.TokenLiteral not let. got=%q", s.TokenLiteral())
-			return
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statement. got=%d",
+				len(program.Statements))
 		}
-		letStmt, ok := s.(*ast.LetStatement)
+
+		returnStmt, ok := program.Statements[0].(*ast.ReturnStatement)
 		if !ok {
-			t.Errorf("Statement is not a LetStatement. got=%T", s)
-			return
+			t.Fatalf("Expected *ast.ReturnStatement, got=%T", program.Statements[0])
 		}
-		if letStmt.Name.Token.Type != token.IDENT {
-			t.Errorf("Identificator token in IDENT. got=%s", letStmt.Name.Token.Type)
-			return
+		if returnStmt.TokenLiteral() != "return" {
+			t.Fatalf("returnStmt.TokenLiteral not 'return', got=%s", returnStmt.TokenLiteral())
 		}
-		if letStmt.Name.Value != tt.expectedIdentifier {
-			t.Errorf("Identificator not '%s'. got=%s", tt.expectedIdentifier, letStmt.Name.Value)
+		if !testLiteralExpression(t, returnStmt.Value, tt.expectedValue) {
 			return
 		}
 	}
 }
 
-func TestReturnStatement(t *testing.T) {
-	input := `
-	return 5;
-	return x;
-	return add(5, x);
-	`
-
-	l := lexer.New(input)
-	p := New(l)
-
-	program := p.ParseProgram()
-	checkParserErrors(t, p)
-
-	if len(program.Statements) != 3 {
-		t.Errorf("Expected 3 statements, got=%d", len(program.Statements))
+func TestStatementStringRoundTrip(t *testing.T) {
+	tests := []string{
+		"let x = (5 * y);",
+		"let flag = (!true);",
+		"return (a + (b * c));",
+		"let x = 5;return x;",
 	}
 
-	for _, stmt := range program.Statements {
-		returnStmt, ok := stmt.(*ast.ReturnStatement)
-		if !ok {
-			t.Errorf("Expected *ast.ReturnStatement, got=%T", stmt)
-			continue
-		}
-		if returnStmt.TokenLiteral() != "return" {
-			t.Errorf("returnStmt.TokenLiteral not 'return', got=%s", returnStmt.TokenLiteral())
+	for _, input := range tests {
+		l := lexer.New(input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != input {
+			t.Errorf("program.String() wrong. expected=%q, got=%q", input, program.String())
 		}
 	}
 }
@@ -166,6 +178,51 @@ func TestIntegerEpression(t *testing.T) {
 	}
 }
 
+func TestNumberLiterals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"0x1F", int64(31)},
+		{"0o17", int64(15)},
+		{"0b101", int64(5)},
+		{"1_000", int64(1000)},
+		{"017", int64(17)},
+		{"9223372036854775807", int64(9223372036854775807)},
+		{"1.5", 1.5},
+		{"1_000.25", 1000.25},
+		{"2e3", 2000.0},
+		{"5E-1", 0.5},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		exp := program.Statements[0].(*ast.ExpressionStatement).Expression
+		switch expected := tt.expected.(type) {
+		case int64:
+			literal, ok := exp.(*ast.IntegerLiteral)
+			if !ok || literal.Value != expected {
+				t.Errorf("%q: expected IntegerLiteral %d. got=%T (%+v)", tt.input, expected, exp, exp)
+			}
+		case float64:
+			literal, ok := exp.(*ast.FloatLiteral)
+			if !ok {
+				t.Errorf("%q: expression not *ast.FloatLiteral. got=%T", tt.input, exp)
+				continue
+			}
+			if literal.Value != expected {
+				t.Errorf("%q: wrong value. expected=%g, got=%g", tt.input, expected, literal.Value)
+			}
+			if literal.TokenLiteral() != tt.input {
+				t.Errorf("%q: wrong TokenLiteral. got=%q", tt.input, literal.TokenLiteral())
+			}
+		}
+	}
+}
+
 func TestPrefixExpression(t *testing.T) {
 	prefixTests := []struct {
 		input    string
@@ -223,6 +280,16 @@ func TestInfixExpressions(t *testing.T) {
 		{"5 < 5;", 5, "<", 5},
 		{"5 == 5;", 5, "==", 5},
 		{"5 != 5;", 5, "!=", 5},
+		{"5 <= 5;", 5, "<=", 5},
+		{"5 >= 5;", 5, ">=", 5},
+		{"5 % 5;", 5, "%", 5},
+		{"5 & 5;", 5, "&", 5},
+		{"5 | 5;", 5, "|", 5},
+		{"5 ^ 5;", 5, "^", 5},
+		{"5 << 5;", 5, "<<", 5},
+		{"5 >> 5;", 5, ">>", 5},
+		{"true && false", true, "&&", false},
+		{"true || false", true, "||", false},
 		{"true == true", true, "==", true},
 		{"true != false", true, "!=", false},
 		{"false == false", false, "==", false},
@@ -341,10 +408,94 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"2 / (5 + 5)",
 			"(2 / (5 + 5))",
 		},
+		{
+			"2.0 * 1e3 + -0.5",
+			"((2.0 * 1000.0) + (-0.5))",
+		},
+		{
+			"a <= b == c >= d",
+			"((a <= b) == (c >= d))",
+		},
+		{
+			"a * b % c + d",
+			"(((a * b) % c) + d)",
+		},
+		{
+			"a || b && c || d",
+			"((a || (b && c)) || d)",
+		},
+		{
+			"a && b == c || !d",
+			"((a && (b == c)) || (!d))",
+		},
+		{
+			"a | b ^ c & d",
+			"((a | b) ^ (c & d))",
+		},
+		{
+			"a & b == c",
+			"((a & b) == c)",
+		},
+		{
+			"a + b & c - d | e",
+			"(((a + (b & c)) - d) | e)",
+		},
+		{
+			"a * b & c % d",
+			"(((a * b) & c) % d)",
+		},
+		{
+			"a | b && c ^ d",
+			"((a | b) && (c ^ d))",
+		},
+		{
+			"1 << 2 + 3 < 4 >> 1",
+			"((1 << (2 + 3)) < (4 >> 1))",
+		},
+		{
+			"a << b << c",
+			"((a << b) << c)",
+		},
+		{
+			"-a % b[0]",
+			"((-a) % (b[0]))",
+		},
 		{
 			"!(true == true)",
 			"(!(true == true))",
 		},
+		{
+			"a + add(b * c) + d",
+			"((a + add((b * c))) + d)",
+		},
+		{
+			"add(a, b, 1, 2 * 3, 4 + 5, add(6, 7 * 8))",
+			"add(a, b, 1, (2 * 3), (4 + 5), add(6, (7 * 8)))",
+		},
+		{
+			"add(a + b + c * d / f + g)",
+			"add((((a + b) + ((c * d) / f)) + g))",
+		},
+		{
+			"a * [1, 2, 3, 4][b * c] * d",
+			"((a * ([1, 2, 3, 4][(b * c)])) * d)",
+		},
+		{
+			"add(a * b[2], b[1], 2 * [1, 2][1])",
+			"add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))",
+		},
+		{
+			"-a[0]",
+			"(-(a[0]))",
+		},
+		{
+			"fns[0](x)",
+			"(fns[0])(x)",
+		},
+		{
+			"{\"a\": 1}[\"a\"] + 1",
+			"(({\"a\": 1}[\"a\"]) + 1)",
+		},
 	}
 
 	for _, tt := range tests {
@@ -454,8 +605,488 @@ func TestIfElseExpression(t *testing.T) {
 	}
 }
 
+func TestFunctionLiteralParsing(t *testing.T) {
+	input := `fn(x, y) { x + y; }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d\n", 1, len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T", program.Statements[0])
+	}
+
+	function, ok := stmt.Expression.(*ast.FunctionLiteral)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.FunctionLiteral. got=%T", stmt.Expression)
+	}
+
+	if len(function.Parameters) != 2 {
+		t.Fatalf("function literal parameters wrong. want 2, got=%d\n", len(function.Parameters))
+	}
+
+	testLiteralExpression(t, function.Parameters[0], "x")
+	testLiteralExpression(t, function.Parameters[1], "y")
+
+	if len(function.Body.Statements) != 1 {
+		t.Fatalf("function.Body.Statements has not 1 statements. got=%d\n", len(function.Body.Statements))
+	}
+
+	bodyStmt, ok := function.Body.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("function body stmt is not ast.ExpressionStatement. got=%T", function.Body.Statements[0])
+	}
+
+	testInfixExpression(t, bodyStmt.Expression, "x", "+", "y")
+}
+
+func TestFunctionParameterParsing(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedParams []string
+	}{
+		{input: "fn() {};", expectedParams: []string{}},
+		{input: "fn(x) {};", expectedParams: []string{"x"}},
+		{input: "fn(x, y, z) {};", expectedParams: []string{"x", "y", "z"}},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		function := stmt.Expression.(*ast.FunctionLiteral)
+
+		if len(function.Parameters) != len(tt.expectedParams) {
+			t.Errorf("length parameters wrong. want %d, got=%d\n", len(tt.expectedParams), len(function.Parameters))
+		}
+
+		for i, ident := range tt.expectedParams {
+			testLiteralExpression(t, function.Parameters[i], ident)
+		}
+	}
+}
+
+func TestCallExpressionParsing(t *testing.T) {
+	input := "add(1, 2 * 3, 4 + 5);"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d\n", 1, len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("stmt is not ast.ExpressionStatement. got=%T", program.Statements[0])
+	}
+
+	exp, ok := stmt.Expression.(*ast.CallExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.CallExpression. got=%T", stmt.Expression)
+	}
+
+	if !testIdentifier(t, exp.Function, "add") {
+		return
+	}
+
+	if len(exp.Arguments) != 3 {
+		t.Fatalf("wrong length of arguments. got=%d", len(exp.Arguments))
+	}
+
+	testLiteralExpression(t, exp.Arguments[0], 1)
+	testInfixExpression(t, exp.Arguments[1], 2, "*", 3)
+	testInfixExpression(t, exp.Arguments[2], 4, "+", 5)
+}
+
+func TestFunctionProgramParsing(t *testing.T) {
+	input := `let add = fn(x, y) { x + y }; add(1, 2 * 3);`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	expected := "let add = fn(x, y) (x + y);add(1, (2 * 3))"
+	if program.String() != expected {
+		t.Errorf("program.String() wrong. expected=%q, got=%q", expected, program.String())
+	}
+}
+
+func TestStringLiteralExpression(t *testing.T) {
+	input := `"hello \"world\"\n";`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	literal, ok := stmt.Expression.(*ast.StringLiteral)
+	if !ok {
+		t.Fatalf("exp not *ast.StringLiteral. got=%T", stmt.Expression)
+	}
+
+	if literal.Value != "hello \"world\"\n" {
+		t.Errorf("literal.Value not %q. got=%q", "hello \"world\"\n", literal.Value)
+	}
+
+	if program.String() != `"hello \"world\"\n"` {
+		t.Errorf("program.String() wrong. got=%q", program.String())
+	}
+}
+
+func TestStringOfSemicolonIsNoTerminator(t *testing.T) {
+	tests := []struct {
+		input              string
+		expectedStatements int
+		expected           string
+	}{
+		{"1\n\";\"", 2, `1";"`},
+		{"1\n\";\" + \"x\"", 2, `1(";" + "x")`},
+		{"f(\";\")", 1, `f(";")`},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != tt.expectedStatements {
+			t.Errorf("wrong number of statements for %q. want=%d, got=%d", tt.input, tt.expectedStatements, len(program.Statements))
+		}
+		if program.String() != tt.expected {
+			t.Errorf("program.String() wrong for %q. want=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+}
+
+func TestParserErrorPositions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"let = 5;", []string{"1:5: Expected IDENT, got ="}},
+		{"add(1,\n 2", []string{"2:3: Expected ), got EOF"}},
+		{"let x = 99999999999999999999;", []string{"1:9: Integer literal 99999999999999999999 out of range"}},
+		{"let x = 0x1_0000_0000_0000_0000;", []string{"1:9: Integer literal 0x1_0000_0000_0000_0000 out of range"}},
+		{"1e400", []string{"1:1: Float literal 1e400 out of range"}},
+		{"\n\n  +;", []string{"3:3: No prefix parse function for +"}},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) < len(tt.expected) {
+			t.Fatalf("wrong number of errors for %q. want=%d, got=%d (%q)", tt.input, len(tt.expected), len(errors), errors)
+		}
+		for i, msg := range tt.expected {
+			if errors[i].Error() != msg {
+				t.Errorf("errors[%d] wrong. want=%q, got=%q", i, msg, errors[i].Error())
+			}
+		}
+	}
+}
+
+func TestNodePositions(t *testing.T) {
+	input := `let f = fn(x) {
+  x * 2
+};
+f(3)`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	let := program.Statements[0].(*ast.LetStatement)
+	fn := let.Value.(*ast.FunctionLiteral)
+	body := fn.Body.Statements[0].(*ast.ExpressionStatement)
+	call := program.Statements[1].(*ast.ExpressionStatement).Expression.(*ast.CallExpression)
+
+	tests := []struct {
+		node     ast.Node
+		expected string
+	}{
+		{program, "1:1"},
+		{let, "1:1"},
+		{let.Name, "1:5"},
+		{fn, "1:9"},
+		{fn.Parameters[0], "1:12"},
+		{fn.Body, "1:15"},
+		{body.Expression, "2:5"},
+		{call, "4:2"},
+		{call.Function, "4:1"},
+	}
+
+	for _, tt := range tests {
+		if tt.node.Pos().String() != tt.expected {
+			t.Errorf("wrong position for %q. want=%s, got=%s", tt.node.String(), tt.expected, tt.node.Pos())
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := `/// add adds
+/// two numbers
+let add = fn(a, b) {
+	/// not a let
+	a + b // sum
+};
+/// too far
+
+let x = 1;
+/// overridden
+// by a plain comment
+let y = 2;
+//// a separator, not a doc comment
+let z = 3;
+/** block */ let w = 4;`
+
+	p := New(lexer.New(input, lexer.WithComments()))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 5 {
+		t.Fatalf("comments must not be parsed as statements. got=%d statements", len(program.Statements))
+	}
+
+	docs := []string{"add adds\ntwo numbers", "", "", "", ""}
+	for i, doc := range docs {
+		let := program.Statements[i].(*ast.LetStatement)
+		if let.Doc != doc {
+			t.Errorf("wrong doc for %s. want=%q, got=%q", let.Name, doc, let.Doc)
+		}
+	}
+
+	comments := []string{}
+	for _, c := range program.Comments {
+		comments = append(comments, c.Pos().String()+" "+c.String())
+	}
+	expected := []string{
+		"1:1 /// add adds",
+		"2:1 /// two numbers",
+		"4:2 /// not a let",
+		"5:8 // sum",
+		"7:1 /// too far",
+		"10:1 /// overridden",
+		"11:1 // by a plain comment",
+		"13:1 //// a separator, not a doc comment",
+		"15:1 /** block */",
+	}
+	if strings.Join(comments, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("wrong comments.\nwant=%q\ngot =%q", expected, comments)
+	}
+
+	body := program.Statements[0].(*ast.LetStatement).Value.(*ast.FunctionLiteral).Body
+	if body.End.String() != "6:1" {
+		t.Errorf("wrong end of block. want=6:1, got=%s", body.End)
+	}
+}
+
+func TestNestingLimit(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{strings.Repeat("-", 100_000) + "1", "1:10001: Expression nested too deeply, more than 10000 levels"},
+		{strings.Repeat("[", 20_000), "1:10001: Expression nested too deeply, more than 10000 levels"},
+		{"let x = " + strings.Repeat("(", 10_000) + "1" + strings.Repeat(")", 10_000), "1:10009: Expression nested too deeply, more than 10000 levels"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != 1 || errors[0].Error() != tt.expected {
+			t.Errorf("wrong errors for %.20q... want=%q, got=%v", tt.input, tt.expected, errors)
+		}
+	}
+
+	// right below the limit is fine
+	p := New(lexer.New(strings.Repeat("-", 9_999) + "1"))
+	p.ParseProgram()
+	checkParserErrors(t, p)
+}
+
+func TestLexerErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{`let s = "abc`, []string{"1:9: unterminated string literal"}},
+		{`"\q"`, []string{`1:2: unknown escape sequence \q`}},
+		{`let a = @;`, []string{`1:9: illegal character '@'`}},
+		{"1 /* open", []string{"1:3: unterminated block comment"}},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != len(tt.expected) {
+			t.Fatalf("wrong number of errors for %q. want=%d, got=%d (%q)", tt.input, len(tt.expected), len(errors), errors)
+		}
+		for i, msg := range tt.expected {
+			if errors[i].Error() != msg {
+				t.Errorf("errors[%d] wrong. want=%q, got=%q", i, msg, errors[i].Error())
+			}
+		}
+	}
+}
+
+func TestParsingArrayLiterals(t *testing.T) {
+	input := "[1, 2 * 2, 3 + 3]"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T", program.Statements[0])
+	}
+
+	array, ok := stmt.Expression.(*ast.ArrayLiteral)
+	if !ok {
+		t.Fatalf("exp not ast.ArrayLiteral. got=%T", stmt.Expression)
+	}
+
+	if len(array.Elements) != 3 {
+		t.Fatalf("len(array.Elements) not 3. got=%d", len(array.Elements))
+	}
+
+	testIntegerLiteral(t, array.Elements[0], 1)
+	testInfixExpression(t, array.Elements[1], 2, "*", 2)
+	testInfixExpression(t, array.Elements[2], 3, "+", 3)
+}
+
+func TestParsingEmptyArrayLiteral(t *testing.T) {
+	input := "[]"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	array, ok := stmt.Expression.(*ast.ArrayLiteral)
+	if !ok {
+		t.Fatalf("exp not ast.ArrayLiteral. got=%T", stmt.Expression)
+	}
+
+	if len(array.Elements) != 0 {
+		t.Errorf("len(array.Elements) not 0. got=%d", len(array.Elements))
+	}
+}
+
+func TestParsingIndexExpressions(t *testing.T) {
+	input := "myArray[1 + 1]"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T", program.Statements[0])
+	}
+
+	indexExp, ok := stmt.Expression.(*ast.IndexExpression)
+	if !ok {
+		t.Fatalf("exp not *ast.IndexExpression. got=%T", stmt.Expression)
+	}
+
+	if !testIdentifier(t, indexExp.Left, "myArray") {
+		return
+	}
+
+	if !testInfixExpression(t, indexExp.Index, 1, "+", 1) {
+		return
+	}
+}
+
+func TestParsingHashLiterals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string // keys and values, alternating
+	}{
+		{`{}`, []string{}},
+		{`{"one": 1, "two": 2, "three": 3}`, []string{`"one"`, "1", `"two"`, "2", `"three"`, "3"}},
+		{`{1: true, false: "no"}`, []string{"1", "true", "false", `"no"`}},
+		{`{"one": 0 + 1, "two": 10 - 8}`, []string{`"one"`, "(0 + 1)", `"two"`, "(10 - 8)"}},
+		{`{x: y}`, []string{"x", "y"}},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		hash, ok := stmt.Expression.(*ast.HashLiteral)
+		if !ok {
+			t.Fatalf("exp is not ast.HashLiteral. got=%T", stmt.Expression)
+		}
+
+		if len(hash.Keys)*2 != len(tt.expected) || len(hash.Values) != len(hash.Keys) {
+			t.Fatalf("hash has wrong number of pairs. got keys=%d, values=%d", len(hash.Keys), len(hash.Values))
+		}
+
+		for i := range hash.Keys {
+			if hash.Keys[i].String() != tt.expected[2*i] {
+				t.Errorf("key %d wrong. want=%s, got=%s", i, tt.expected[2*i], hash.Keys[i].String())
+			}
+			if hash.Values[i].String() != tt.expected[2*i+1] {
+				t.Errorf("value %d wrong. want=%s, got=%s", i, tt.expected[2*i+1], hash.Values[i].String())
+			}
+		}
+	}
+}
+
 // helpers
 
+func testLetStatement(t *testing.T, s ast.Statement, name string) bool {
+	if s.TokenLiteral() != "let" {
+		t.Errorf("letStmt.TokenLiteral not let. got=%q", s.TokenLiteral())
+		return false
+	}
+	letStmt, ok := s.(*ast.LetStatement)
+	if !ok {
+		t.Errorf("Statement is not a LetStatement. got=%T", s)
+		return false
+	}
+	if letStmt.Name.Token.Type != token.IDENT {
+		t.Errorf("Identificator token in IDENT. got=%s", letStmt.Name.Token.Type)
+		return false
+	}
+	if letStmt.Name.Value != name {
+		t.Errorf("Identificator not '%s'. got=%s", name, letStmt.Name.Value)
+		return false
+	}
+	return true
+}
+
 func testInfixExpression(t *testing.T, exp ast.Expression, left interface{}, operator string, right interface{}) bool {
 	opExp, ok := exp.(*ast.InfixExpression)
 	if !ok {
@@ -553,12 +1184,13 @@ func testIntegerLiteral(t *testing.T, il ast.Expression, value int64) bool {
 }
 
 func checkParserErrors(t *testing.T, p *Parser) {
-	if len(p.errors) == 0 {
+	errors := p.Errors()
+	if len(errors) == 0 {
 		return
 	} else {
-		t.Errorf("Parser has %d errors.", len(p.errors))
-		for _, e := range p.errors {
-			t.Errorf("parser error: %q", e)
+		t.Errorf("Parser has %d errors.", len(errors))
+		for _, e := range errors {
+			t.Errorf("parser error: %q", e.Error())
 		}
 		t.FailNow()
 	}
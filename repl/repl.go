@@ -4,28 +4,214 @@ import (
 	"bufio"
 	"fmt"
 	"io"
+	"os"
+	"strings"
+	"waiig/ast"
 	"waiig/lexer"
+	"waiig/object"
+	"waiig/parser"
 	"waiig/token"
 )
 
 const (
-	PROMPT = ">> "
+	PROMPT              = ">> "
+	CONTINUATION_PROMPT = ".. "
 )
 
-func Start(in io.Reader, out io.Writer) {
+// Engine selects the backend that runs the parsed program
+type Engine string
+
+const (
+	EngineEval Engine = "eval"
+	EngineVM   Engine = "vm"
+)
+
+// Mode is what the REPL does with the input, it's switched with commands
+type Mode string
+
+const (
+	ModeTokens   Mode = "tokens"
+	ModeAST      Mode = "ast"
+	ModeEval     Mode = "eval"
+	ModeBytecode Mode = "bytecode"
+)
+
+const HELP = `:eval            evaluate the input (default)
+:tokens          print the tokens of the input
+:ast             print the input as parsed, then as a tree
+:bytecode        print the compiled input
+:load file.mk    run a file in the session
+:env             list the bindings of the session
+:reset           clear the bindings of the session
+:help            show this help
+`
+
+func Start(in io.Reader, out io.Writer, engine Engine) {
 	scanner := bufio.NewScanner(in)
+	session := NewSession(engine)
+	session.SetOutput(out)
+	mode := ModeEval
 
 	for {
-		fmt.Printf(PROMPT)
+		fmt.Fprint(out, PROMPT)
 
-		scanned := scanner.Scan()
-		if !scanned {
+		source, ok := readInput(scanner, out)
+		if !ok {
 			return
 		}
-		l := lexer.New(scanner.Text())
 
-		for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
-			fmt.Printf("%+v\n", tok)
+		if strings.HasPrefix(strings.TrimSpace(source), ":") {
+			mode = runCommand(out, session, mode, strings.TrimSpace(source))
+			continue
 		}
+
+		run(out, session, mode, source)
 	}
 }
+
+// readInput reads lines until every brace, paren and bracket opened in them is
+// closed, showing the continuation prompt in between. It returns false once
+// the input is exhausted and nothing is left to evaluate
+func readInput(scanner *bufio.Scanner, out io.Writer) (string, bool) {
+	if !scanner.Scan() {
+		return "", false
+	}
+	source := scanner.Text()
+
+	for !isComplete(source) {
+		fmt.Fprint(out, CONTINUATION_PROMPT)
+
+		if !scanner.Scan() {
+			// evaluate what we have so the user sees why it's incomplete
+			break
+		}
+		source += "\n" + scanner.Text()
+	}
+
+	return source, true
+}
+
+// isComplete reports whether source has no unclosed braces, parens or brackets.
+// Too many closing ones count as complete, the parser reports those
+func isComplete(source string) bool {
+	depth := 0
+
+	l := lexer.New(source)
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		switch tok.Type {
+		case token.LBRACE, token.LPAREN, token.LBRACKET:
+			depth++
+		case token.RBRACE, token.RPAREN, token.RBRACKET:
+			depth--
+		}
+	}
+
+	return depth <= 0
+}
+
+func run(out io.Writer, session *Session, mode Mode, source string) {
+	if mode == ModeTokens {
+		printTokens(out, source)
+		return
+	}
+
+	l := lexer.New(source)
+	p := parser.New(l)
+
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		printParserErrors(out, source, p.Errors())
+		return
+	}
+
+	switch mode {
+	case ModeAST:
+		fmt.Fprintln(out, program.String())
+		fmt.Fprint(out, ast.Tree(program))
+
+	case ModeBytecode:
+		bytecode, err := session.Bytecode(program)
+		if err != nil {
+			fmt.Fprintf(out, "ERROR: %s\n", err)
+			return
+		}
+		fmt.Fprint(out, bytecode)
+
+	default:
+		result := session.Eval(program)
+		if result != nil {
+			fmt.Fprintln(out, result.Inspect())
+		}
+	}
+}
+
+// runCommand handles the REPL's own commands, which start with a colon, and
+// returns the mode the REPL is in afterwards
+func runCommand(out io.Writer, session *Session, mode Mode, command string) Mode {
+	fields := strings.Fields(command)
+
+	switch fields[0] {
+	case ":tokens":
+		return ModeTokens
+	case ":ast":
+		return ModeAST
+	case ":eval":
+		return ModeEval
+	case ":bytecode":
+		return ModeBytecode
+	case ":load":
+		if len(fields) != 2 {
+			fmt.Fprintln(out, "usage: :load file.mk")
+			break
+		}
+		load(out, session, fields[1])
+	case ":reset":
+		session.Reset()
+	case ":env":
+		for _, b := range session.Bindings() {
+			fmt.Fprintln(out, b)
+		}
+	case ":help":
+		fmt.Fprint(out, HELP)
+	default:
+		fmt.Fprintf(out, "unknown command %s, try :help\n", fields[0])
+	}
+
+	return mode
+}
+
+// load evaluates a file in the session, only errors are printed
+func load(out io.Writer, session *Session, path string) {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintf(out, "ERROR: %s\n", err)
+		return
+	}
+
+	l := lexer.New(string(source))
+	p := parser.New(l)
+
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		fmt.Fprintf(out, "%s:\n", path)
+		printParserErrors(out, string(source), p.Errors())
+		return
+	}
+
+	// the errors' Inspect includes the Monkey stack trace
+	switch result := session.Eval(program).(type) {
+	case *object.Error, *object.LimitError:
+		fmt.Fprintf(out, "%s: %s\n", path, result.Inspect())
+	}
+}
+
+func printTokens(out io.Writer, source string) {
+	l := lexer.New(source)
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		fmt.Fprintf(out, "%s\t%s\t%q\n", tok.Pos, tok.Type, tok.Literal)
+	}
+}
+
+func printParserErrors(out io.Writer, source string, errors []*parser.ParseError) {
+	fmt.Fprintln(out, parser.Diagnostics(source, errors))
+}
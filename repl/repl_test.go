@@ -0,0 +1,259 @@
+package repl
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"waiig/ast"
+	"waiig/lexer"
+	"waiig/object"
+	"waiig/parser"
+)
+
+func TestStartEngines(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 + 2", "3"},
+		{"let add = fn(a, b) { a + b }; add(2, 3)", "5"},
+		{`len("monkey")`, "6"},
+		{"[1, 2, 3][1]", "2"},
+		{"if (false) { 1 }", "null"},
+		{`puts("hi"); 1`, "hi\n1"},
+	}
+
+	for _, engine := range []Engine{EngineEval, EngineVM} {
+		for _, tt := range tests {
+			var out bytes.Buffer
+			Start(strings.NewReader(tt.input), &out, engine)
+
+			expected := PROMPT + tt.expected + "\n" + PROMPT
+			if out.String() != expected {
+				t.Errorf("%s: wrong output for %q. want=%q, got=%q", engine, tt.input, expected, out.String())
+			}
+		}
+	}
+}
+
+func TestStartContinuation(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			"fn(a, b) {\n  a + b\n}(1, 2)",
+			PROMPT + CONTINUATION_PROMPT + CONTINUATION_PROMPT + "3\n" + PROMPT,
+		},
+		{
+			"[1,\n2,\n3][2]",
+			PROMPT + CONTINUATION_PROMPT + CONTINUATION_PROMPT + "3\n" + PROMPT,
+		},
+		{
+			"len(\"a\", \"b\"\n)",
+			PROMPT + CONTINUATION_PROMPT + "ERROR: 1:4: wrong number of arguments to `len`: got=2, want=1\n" + PROMPT,
+		},
+		{
+			"if (true) {\n1",
+			PROMPT + CONTINUATION_PROMPT + CONTINUATION_PROMPT + "1\n" + PROMPT,
+		},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		Start(strings.NewReader(tt.input), &out, EngineEval)
+
+		if out.String() != tt.expected {
+			t.Errorf("wrong output for %q.\nwant=%q\ngot =%q", tt.input, tt.expected, out.String())
+		}
+	}
+}
+
+func TestIsComplete(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"let x = 5;", true},
+		{"let f = fn(x) {", false},
+		{"let f = fn(x) { x }", true},
+		{"if (x", false},
+		{"[1, 2", false},
+		{"{\"a\": [1, 2]}", true},
+		{"\"{\"", true},
+		{"}", true},
+	}
+
+	for _, tt := range tests {
+		if got := isComplete(tt.input); got != tt.expected {
+			t.Errorf("isComplete(%q) wrong. want=%t, got=%t", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestSessionPersistsBindings(t *testing.T) {
+	input := `let x = 5;
+let double = fn(n) { n * 2 };
+double(x)
+:env
+:reset
+:env
+x`
+
+	expected := map[Engine]string{
+		EngineEval: PROMPT + PROMPT + PROMPT + "10\n" +
+			PROMPT + "double: FUNCTION\nx: INTEGER\n" +
+			PROMPT + PROMPT +
+			PROMPT + "ERROR: 1:1: identifier not found: x\n" + PROMPT,
+		EngineVM: PROMPT + PROMPT + PROMPT + "10\n" +
+			PROMPT + "double: CLOSURE\nx: INTEGER\n" +
+			PROMPT + PROMPT +
+			PROMPT + "ERROR: 1:1: identifier not found: x\n" + PROMPT,
+	}
+
+	for engine, want := range expected {
+		var out bytes.Buffer
+		Start(strings.NewReader(input), &out, engine)
+
+		if out.String() != want {
+			t.Errorf("%s: wrong output.\nwant=%q\ngot =%q", engine, want, out.String())
+		}
+	}
+}
+
+func TestSessionRecoversFromCompileErrors(t *testing.T) {
+	inputs := []string{"let f = fn() { y };", "f()", "let f = 1; f + 1"}
+
+	// the VM doesn't compile f, so f mustn't be left defined without a value.
+	// The evaluator only finds out about y when f is called
+	expected := map[Engine][]string{
+		EngineEval: {
+			"",
+			"ERROR: 1:16: identifier not found: y\n\tin f called at 1:2",
+			"2",
+		},
+		EngineVM: {
+			"ERROR: 1:16: identifier not found: y",
+			"ERROR: 1:1: identifier not found: f",
+			"2",
+		},
+	}
+
+	for engine, want := range expected {
+		session := NewSession(engine)
+
+		for i, input := range inputs {
+			got := ""
+			if result := session.Eval(parseProgram(t, input)); result != nil {
+				got = result.Inspect()
+			}
+			if got != want[i] {
+				t.Errorf("%s: wrong result for %q. want=%q, got=%q", engine, input, want[i], got)
+			}
+		}
+	}
+}
+
+func parseProgram(t *testing.T, input string) *ast.Program {
+	t.Helper()
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.Errors())
+	}
+	return program
+}
+
+func TestCommands(t *testing.T) {
+	dir := t.TempDir()
+	lib := filepath.Join(dir, "lib.mk")
+	if err := os.WriteFile(lib, []byte("let square = fn(x) { x * x };\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	broken := filepath.Join(dir, "broken.mk")
+	if err := os.WriteFile(broken, []byte("let = 1;\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	failing := filepath.Join(dir, "failing.mk")
+	if err := os.WriteFile(failing, []byte("let inc = fn(x) { x + true };\ninc(1);\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	runaway := filepath.Join(dir, "runaway.mk")
+	if err := os.WriteFile(runaway, []byte("let f = fn() { f() };\nf();\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			":tokens\nlet x",
+			PROMPT + PROMPT + "1:1\tLET\t\"let\"\n1:5\tIDENT\t\"x\"\n" + PROMPT,
+		},
+		{
+			":ast\n-a * b",
+			PROMPT + PROMPT + "((-a) * b)\nProgram\n  ExpressionStatement\n    InfixExpression *\n" +
+				"      PrefixExpression -\n        Identifier a\n      Identifier b\n" + PROMPT,
+		},
+		{
+			"let a = 1;\n:bytecode\na + 2\n:eval\na + 2",
+			PROMPT + PROMPT + PROMPT +
+				"0000 OpGetGlobal 0\n0003 OpConstant 0\n0006 OpAdd\n0007 OpPop\nconstants:\n0: INTEGER 2\n" +
+				PROMPT + PROMPT + "3\n" + PROMPT,
+		},
+		{
+			":load " + lib + "\nsquare(4)",
+			PROMPT + PROMPT + "16\n" + PROMPT,
+		},
+		{
+			":load " + broken,
+			PROMPT + broken + ":\n1:5: Expected IDENT, got =\nlet = 1;\n    ^\n" + PROMPT,
+		},
+		{
+			":load " + failing,
+			PROMPT + failing + ": ERROR: 1:21: type mismatch: INTEGER + BOOLEAN\n\tin inc called at 2:4\n" + PROMPT,
+		},
+		{
+			":load " + runaway,
+			PROMPT + runaway + ": LIMIT EXCEEDED: 1:17: maximum recursion depth exceeded: 10000 nested calls\n" +
+				"\tin f called at 1:17\n\t[previous call repeated 9998 more times]\n\tin f called at 2:2\n" + PROMPT,
+		},
+		{
+			":load",
+			PROMPT + "usage: :load file.mk\n" + PROMPT,
+		},
+		{
+			":help",
+			PROMPT + HELP + PROMPT,
+		},
+		{
+			":frobnicate",
+			PROMPT + "unknown command :frobnicate, try :help\n" + PROMPT,
+		},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		Start(strings.NewReader(tt.input), &out, EngineEval)
+
+		if out.String() != tt.expected {
+			t.Errorf("wrong output for %q.\nwant=%q\ngot =%q", tt.input, tt.expected, out.String())
+		}
+	}
+}
+
+func TestSessionSet(t *testing.T) {
+	for _, engine := range []Engine{EngineEval, EngineVM} {
+		session := NewSession(engine)
+		session.Set("greeting", &object.String{Value: "hello"})
+
+		result := session.Eval(parseProgram(t, `greeting + " world"`))
+		if result == nil || result.Inspect() != "hello world" {
+			t.Errorf("%s: wrong result. got=%v", engine, result)
+		}
+	}
+}
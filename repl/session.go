@@ -0,0 +1,204 @@
+package repl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"waiig/ast"
+	"waiig/compiler"
+	"waiig/evaluator"
+	"waiig/object"
+	"waiig/vm"
+)
+
+// Session keeps the state of a REPL between inputs, so a let on one line is
+// visible on the next
+type Session struct {
+	Engine Engine
+
+	env *object.Environment
+
+	// puts is bound in the session, it prints to output
+	puts   *object.Builtin
+	output io.Writer
+
+	// the VM needs the symbol table and the constants of earlier compilations
+	// along with the globals they refer to
+	symbolTable *compiler.SymbolTable
+	constants   []object.Object
+	globals     []object.Object
+}
+
+func NewSession(engine Engine) *Session {
+	s := &Session{Engine: engine, output: os.Stdout}
+	s.puts = object.NewPuts(sessionOutput{s})
+	s.Reset()
+	return s
+}
+
+// Reset forgets every binding made in the session
+func (s *Session) Reset() {
+	s.env = object.NewEnvironment()
+	s.symbolTable = compiler.NewSymbolTableWithBuiltins()
+	s.constants = []object.Object{}
+	s.globals = vm.NewGlobalsStore()
+	s.Set(s.puts.Name, s.puts)
+}
+
+// SetOutput makes puts print to w from now on, it prints to standard output
+// until then
+func (s *Session) SetOutput(w io.Writer) {
+	s.output = w
+}
+
+// sessionOutput writes to the session's current output, so puts doesn't have to
+// be bound again when the output changes
+type sessionOutput struct{ s *Session }
+
+func (o sessionOutput) Write(p []byte) (int, error) {
+	return o.s.output.Write(p)
+}
+
+// Set binds name to value in the session, the way a let statement would
+func (s *Session) Set(name string, value object.Object) {
+	if s.Engine != EngineVM {
+		s.env.Set(name, value)
+		return
+	}
+
+	symbol := s.symbolTable.Define(name)
+	s.globals[symbol.Index] = value
+}
+
+// Eval runs the program in the session. Compile and runtime errors of the VM
+// are returned as error objects, so they print like the evaluator's
+func (s *Session) Eval(program *ast.Program) object.Object {
+	return s.EvalContext(context.Background(), program, evaluator.Limits{})
+}
+
+// EvalContext runs the program like Eval, within the given limits. Only the
+// evaluator enforces them, the VM runs without limits
+func (s *Session) EvalContext(ctx context.Context, program *ast.Program, limits evaluator.Limits) object.Object {
+	if s.Engine != EngineVM {
+		return evaluator.EvalContext(ctx, program, s.env, limits)
+	}
+
+	// the compiler defines the name of a let before it compiles the value, a
+	// program that doesn't compile mustn't leave a name without a value behind
+	symbolTable := s.symbolTable.Copy()
+	comp := compiler.NewWithState(symbolTable, s.constants)
+	if err := comp.Compile(program); err != nil {
+		return errorObject(err)
+	}
+
+	code := comp.Bytecode()
+	s.symbolTable = symbolTable
+	s.constants = code.Constants
+
+	machine := vm.NewWithGlobalsStore(code, s.globals)
+	if err := machine.Run(); err != nil {
+		return errorObject(err)
+	}
+
+	// the stack still holds whatever an earlier statement left there, a let
+	// has no value of its own
+	if n := len(program.Statements); n == 0 {
+		return nil
+	} else if _, ok := program.Statements[n-1].(*ast.LetStatement); ok {
+		return nil
+	}
+
+	return machine.LastPoppedStackElem()
+}
+
+// Footprint estimates the bytes the values bound in the session keep alive
+func (s *Session) Footprint() int64 {
+	var values []object.Object
+	if s.Engine != EngineVM {
+		for _, name := range s.env.Names() {
+			value, _ := s.env.Get(name)
+			values = append(values, value)
+		}
+		return object.Footprint(values...)
+	}
+
+	for _, value := range s.globals {
+		if value != nil {
+			values = append(values, value)
+		}
+	}
+	return object.Footprint(append(values, s.constants...)...)
+}
+
+// errorObject turns an error of the compiler or the VM into an error object with
+// the position and the stack trace the evaluator's errors have
+func errorObject(err error) *object.Error {
+	var compileErr *compiler.Error
+	var runtimeErr *vm.Error
+
+	switch {
+	case errors.As(err, &compileErr):
+		return &object.Error{Message: compileErr.Message, Pos: compileErr.Pos}
+	case errors.As(err, &runtimeErr):
+		return &object.Error{Message: runtimeErr.Message, Pos: runtimeErr.Pos, Stack: runtimeErr.Stack}
+	default:
+		return &object.Error{Message: err.Error()}
+	}
+}
+
+// Bytecode compiles the program without running it. The names bound in the
+// session resolve, but not necessarily to the slots the session's VM uses
+func (s *Session) Bytecode(program *ast.Program) (*compiler.Bytecode, error) {
+	symbolTable := compiler.NewSymbolTableWithBuiltins()
+	for _, b := range s.Bindings() {
+		symbolTable.Define(b.Name)
+	}
+
+	comp := compiler.NewWithState(symbolTable, []object.Object{})
+	if err := comp.Compile(program); err != nil {
+		return nil, err
+	}
+	return comp.Bytecode(), nil
+}
+
+// Binding is a name defined in the session along with its current value
+type Binding struct {
+	Name  string
+	Value object.Object
+}
+
+// Bindings lists the names defined in the session in alphabetical order
+func (s *Session) Bindings() []Binding {
+	bindings := []Binding{}
+
+	if s.Engine != EngineVM {
+		for _, name := range s.env.Names() {
+			value, _ := s.env.Get(name)
+			if s.isOwnPuts(name, value) {
+				continue
+			}
+			bindings = append(bindings, Binding{Name: name, Value: value})
+		}
+		return bindings
+	}
+
+	for _, symbol := range s.symbolTable.Symbols() {
+		if symbol.Scope != compiler.GlobalScope || s.globals[symbol.Index] == nil || s.isOwnPuts(symbol.Name, s.globals[symbol.Index]) {
+			continue
+		}
+		bindings = append(bindings, Binding{Name: symbol.Name, Value: s.globals[symbol.Index]})
+	}
+	return bindings
+}
+
+// isOwnPuts tells the puts the session binds apart from the bindings made in
+// it, including one that copies puts under another name
+func (s *Session) isOwnPuts(name string, value object.Object) bool {
+	return name == s.puts.Name && value == s.puts
+}
+
+func (b Binding) String() string {
+	return fmt.Sprintf("%s: %s", b.Name, b.Value.Type())
+}
@@ -1,36 +1,74 @@
 package token
 
+import "fmt"
+
 type TokenType string
 
 type Token struct {
 	Type    TokenType
 	Literal string
+	Pos     Position // where the token starts in the input
+}
+
+// Position is a location in the input. Line and Column start at 1, Offset is
+// the number of bytes before the position and starts at 0
+type Position struct {
+	Offset int
+	Line   int
+	Column int
+}
+
+// IsValid reports whether the position was set, the zero Position isn't valid
+func (p Position) IsValid() bool { return p.Line > 0 }
+
+func (p Position) String() string {
+	if !p.IsValid() {
+		return "-"
+	}
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
 }
 
 const (
 	ILLEGAL = "ILLEGAL"
 	EOF     = "EOF"
+	COMMENT = "COMMENT" // only produced when the lexer is asked to keep comments
 	// Identifiers + literals
-	IDENT = "IDENT" // add, foobar, x, y, ...
-	INT   = "INT"
+	IDENT  = "IDENT" // add, foobar, x, y, ...
+	INT    = "INT"
+	FLOAT  = "FLOAT"
+	STRING = "STRING"
 	// Operators
 	ASSIGN   = "="
 	PLUS     = "+"
 	MINUS    = "-"
 	SLASH    = "/"
 	ASTERISK = "*"
+	PERCENT  = "%"
 	LT       = "<"
 	GT       = ">"
+	LT_EQ    = "<="
+	GT_EQ    = ">="
 	EQ       = "=="
 	NOT_EQ   = "!="
 	BANG     = "!"
+	AND      = "&&"
+	OR       = "||"
+	// Bitwise operators
+	AMPERSAND   = "&"
+	PIPE        = "|"
+	CARET       = "^"
+	SHIFT_LEFT  = "<<"
+	SHIFT_RIGHT = ">>"
 	// Delimiters
 	COMMA     = ","
 	SEMICOLON = ";"
+	COLON     = ":"
 	LPAREN    = "("
 	RPAREN    = ")"
 	LBRACE    = "{"
 	RBRACE    = "}"
+	LBRACKET  = "["
+	RBRACKET  = "]"
 	// Keywords
 	// 1343456
 	FUNCTION = "FUNCTION"
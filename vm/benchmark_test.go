@@ -0,0 +1,51 @@
+package vm
+
+import (
+	"testing"
+	"waiig/compiler"
+	"waiig/evaluator"
+	"waiig/object"
+)
+
+const fibonacci = `
+let fibonacci = fn(x) {
+	if (x == 0) {
+		0
+	} else {
+		if (x == 1) {
+			return 1;
+		} else {
+			fibonacci(x - 1) + fibonacci(x - 2);
+		}
+	}
+};
+fibonacci(20);
+`
+
+func BenchmarkFibonacciVM(b *testing.B) {
+	program := parse(fibonacci)
+
+	for i := 0; i < b.N; i++ {
+		comp := compiler.New()
+		if err := comp.Compile(program); err != nil {
+			b.Fatalf("compiler error: %s", err)
+		}
+
+		machine := New(comp.Bytecode())
+		if err := machine.Run(); err != nil {
+			b.Fatalf("vm error: %s", err)
+		}
+	}
+}
+
+func BenchmarkFibonacciEvaluator(b *testing.B) {
+	program := parse(fibonacci)
+
+	for i := 0; i < b.N; i++ {
+		env := object.NewEnvironment()
+		result := evaluator.Eval(program, env)
+		if result.Type() == object.ERROR_OBJ {
+			b.Fatalf("evaluator error: %s", result.Inspect())
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package vm
+
+import (
+	"waiig/code"
+	"waiig/object"
+	"waiig/token"
+)
+
+// Frame is the call frame of a closure being executed
+type Frame struct {
+	cl          *object.Closure
+	ip          int // instruction pointer within the closure's instructions
+	basePointer int // stack pointer before the call, locals are stored from here
+}
+
+func NewFrame(cl *object.Closure, basePointer int) *Frame {
+	return &Frame{cl: cl, ip: -1, basePointer: basePointer}
+}
+
+func (f *Frame) Instructions() code.Instructions {
+	return f.cl.Fn.Instructions
+}
+
+// position returns where the instruction at ip was compiled from
+func (f *Frame) position(ip int) token.Position {
+	return f.cl.Fn.Positions[ip]
+}
@@ -0,0 +1,756 @@
+package vm
+
+import (
+	"fmt"
+	"math"
+	"waiig/code"
+	"waiig/compiler"
+	"waiig/object"
+	"waiig/token"
+)
+
+const StackSize = 2048
+const GlobalsSize = 65536
+const MaxFrames = 1024
+
+// As in the evaluator, there is only ever one true, one false and one null
+var (
+	True  = &object.Boolean{Value: true}
+	False = &object.Boolean{Value: false}
+	Null  = &object.Null{}
+)
+
+type VM struct {
+	constants []object.Object
+
+	stack []object.Object
+	sp    int // always points to the next free slot, the top of stack is stack[sp-1]
+
+	globals []object.Object
+
+	frames      []*Frame
+	framesIndex int
+}
+
+func New(bytecode *compiler.Bytecode) *VM {
+	return NewWithGlobalsStore(bytecode, NewGlobalsStore())
+}
+
+// NewWithGlobalsStore creates a VM that uses the given globals, so a REPL can
+// keep them between runs
+func NewWithGlobalsStore(bytecode *compiler.Bytecode, s []object.Object) *VM {
+	mainFn := &object.CompiledFunction{Instructions: bytecode.Instructions, Positions: bytecode.Positions}
+	mainClosure := &object.Closure{Fn: mainFn}
+	mainFrame := NewFrame(mainClosure, 0)
+
+	frames := make([]*Frame, MaxFrames)
+	frames[0] = mainFrame
+
+	return &VM{
+		constants: bytecode.Constants,
+
+		stack: make([]object.Object, StackSize),
+		sp:    0,
+
+		globals: s,
+
+		frames:      frames,
+		framesIndex: 1,
+	}
+}
+
+// NewGlobalsStore returns an empty globals store for NewWithGlobalsStore
+func NewGlobalsStore() []object.Object {
+	return make([]object.Object, GlobalsSize)
+}
+
+// LastPoppedStackElem is the result of the last expression statement
+func (vm *VM) LastPoppedStackElem() object.Object {
+	return vm.stack[vm.sp]
+}
+
+// Run executes the bytecode. A runtime error is returned as an *Error that
+// says where the failing instruction was compiled from
+func (vm *VM) Run() (err error) {
+	var ip int
+	var ins code.Instructions
+	var op code.Opcode
+
+	defer func() {
+		if err != nil {
+			err = vm.newError(ip, err)
+		}
+	}()
+
+	for vm.currentFrame().ip < len(vm.currentFrame().Instructions())-1 {
+		vm.currentFrame().ip++
+
+		ip = vm.currentFrame().ip
+		ins = vm.currentFrame().Instructions()
+		op = code.Opcode(ins[ip])
+
+		switch op {
+		case code.OpConstant:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			if err := vm.push(vm.constants[constIndex]); err != nil {
+				return err
+			}
+
+		case code.OpPop:
+			vm.pop()
+
+		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv, code.OpMod,
+			code.OpBitAnd, code.OpBitOr, code.OpBitXor, code.OpShiftLeft, code.OpShiftRight:
+			if err := vm.executeBinaryOperation(op); err != nil {
+				return err
+			}
+
+		case code.OpTrue:
+			if err := vm.push(True); err != nil {
+				return err
+			}
+
+		case code.OpFalse:
+			if err := vm.push(False); err != nil {
+				return err
+			}
+
+		case code.OpNull:
+			if err := vm.push(Null); err != nil {
+				return err
+			}
+
+		case code.OpEqual, code.OpNotEqual, code.OpGreaterThan, code.OpGreaterThanOrEqual,
+			code.OpLessThan, code.OpLessThanOrEqual:
+			if err := vm.executeComparison(op); err != nil {
+				return err
+			}
+
+		case code.OpBang:
+			if err := vm.executeBangOperator(); err != nil {
+				return err
+			}
+
+		case code.OpMinus:
+			if err := vm.executeMinusOperator(); err != nil {
+				return err
+			}
+
+		case code.OpJump:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			// the loop increments ip before the next instruction is read
+			vm.currentFrame().ip = pos - 1
+
+		case code.OpJumpNotTruthy:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			condition := vm.pop()
+			if !isTruthy(condition) {
+				vm.currentFrame().ip = pos - 1
+			}
+
+		case code.OpSetGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			vm.globals[globalIndex] = vm.pop()
+
+		case code.OpGetGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			// a global is left unset when compiling its let failed half way,
+			// which can happen when the globals are kept between runs
+			if vm.globals[globalIndex] == nil {
+				return fmt.Errorf("global %d used before it was set", globalIndex)
+			}
+			if err := vm.push(vm.globals[globalIndex]); err != nil {
+				return err
+			}
+
+		case code.OpSetLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			frame := vm.currentFrame()
+			vm.stack[frame.basePointer+int(localIndex)] = vm.pop()
+
+		case code.OpGetLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			frame := vm.currentFrame()
+			if err := vm.push(vm.stack[frame.basePointer+int(localIndex)]); err != nil {
+				return err
+			}
+
+		case code.OpGetBuiltin:
+			builtinIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			builtin := object.GetBuiltin(int(builtinIndex))
+			if builtin == nil {
+				return fmt.Errorf("builtin %d is not registered", builtinIndex)
+			}
+			if err := vm.push(builtin); err != nil {
+				return err
+			}
+
+		case code.OpGetFree:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			currentClosure := vm.currentFrame().cl
+			if err := vm.push(currentClosure.Free[freeIndex]); err != nil {
+				return err
+			}
+
+		case code.OpCurrentClosure:
+			if err := vm.push(vm.currentFrame().cl); err != nil {
+				return err
+			}
+
+		case code.OpArray:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			array := vm.buildArray(vm.sp-numElements, vm.sp)
+			vm.sp = vm.sp - numElements
+
+			if err := vm.push(array); err != nil {
+				return err
+			}
+
+		case code.OpHash:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			hash, err := vm.buildHash(vm.sp-numElements, vm.sp)
+			if err != nil {
+				return err
+			}
+			vm.sp = vm.sp - numElements
+
+			if err := vm.push(hash); err != nil {
+				return err
+			}
+
+		case code.OpIndex:
+			index := vm.pop()
+			left := vm.pop()
+
+			if err := vm.executeIndexExpression(left, index); err != nil {
+				return err
+			}
+
+		case code.OpCall:
+			numArgs := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			if err := vm.executeCall(int(numArgs)); err != nil {
+				return err
+			}
+
+		case code.OpReturnValue:
+			returnValue := vm.pop()
+
+			// a return at the top level ends the program, the same as in the
+			// evaluator. Leave the value where LastPoppedStackElem finds it
+			if vm.framesIndex == 1 {
+				vm.stack[vm.sp] = returnValue
+				return nil
+			}
+
+			frame := vm.popFrame()
+			// the -1 also removes the closure that was called
+			vm.sp = frame.basePointer - 1
+
+			if err := vm.push(returnValue); err != nil {
+				return err
+			}
+
+		case code.OpReturn:
+			frame := vm.popFrame()
+			vm.sp = frame.basePointer - 1
+
+			if err := vm.push(Null); err != nil {
+				return err
+			}
+
+		case code.OpClosure:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			numFree := code.ReadUint8(ins[ip+3:])
+			vm.currentFrame().ip += 3
+
+			if err := vm.pushClosure(int(constIndex), int(numFree)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Error is a runtime error, Pos is where the failing instruction was compiled
+// from. It's the zero Position when the bytecode doesn't record positions
+type Error struct {
+	Message string
+	Pos     token.Position
+	Stack   []object.Frame // the calls in progress, innermost first
+}
+
+func (e *Error) Error() string {
+	if e.Pos.IsValid() {
+		return fmt.Sprintf("%s: %s", e.Pos, e.Message)
+	}
+	return e.Message
+}
+
+// newError turns err, returned by the instruction at ip of the current frame,
+// into an *Error. Every frame but the main one is a call in progress, which was
+// made by the OpCall its caller stopped at
+func (vm *VM) newError(ip int, err error) *Error {
+	e := &Error{Message: err.Error(), Pos: vm.currentFrame().position(ip)}
+
+	for i := vm.framesIndex - 1; i > 0; i-- {
+		name := vm.frames[i].cl.Fn.Name
+		if name == "" {
+			name = "<anonymous>"
+		}
+		caller := vm.frames[i-1]
+		// the caller's ip is at the operand of the OpCall
+		e.Stack = append(e.Stack, object.Frame{Function: name, Pos: caller.position(caller.ip - 1)})
+	}
+
+	return e
+}
+
+func (vm *VM) push(o object.Object) error {
+	if vm.sp >= StackSize {
+		return fmt.Errorf("stack overflow")
+	}
+
+	vm.stack[vm.sp] = o
+	vm.sp++
+
+	return nil
+}
+
+func (vm *VM) pop() object.Object {
+	o := vm.stack[vm.sp-1]
+	vm.sp--
+	return o
+}
+
+func (vm *VM) currentFrame() *Frame {
+	return vm.frames[vm.framesIndex-1]
+}
+
+func (vm *VM) pushFrame(f *Frame) error {
+	if vm.framesIndex >= MaxFrames {
+		return fmt.Errorf("maximum recursion depth exceeded: %d nested calls", MaxFrames-1)
+	}
+	vm.frames[vm.framesIndex] = f
+	vm.framesIndex++
+	return nil
+}
+
+func (vm *VM) popFrame() *Frame {
+	vm.framesIndex--
+	return vm.frames[vm.framesIndex]
+}
+
+func (vm *VM) executeBinaryOperation(op code.Opcode) error {
+	right := vm.pop()
+	left := vm.pop()
+
+	leftType := left.Type()
+	rightType := right.Type()
+
+	switch {
+	case leftType == object.INTEGER_OBJ && rightType == object.INTEGER_OBJ:
+		return vm.executeBinaryIntegerOperation(op, left, right)
+	case isNumber(left) && isNumber(right):
+		return vm.executeBinaryFloatOperation(op, left, right)
+	case leftType == object.STRING_OBJ && rightType == object.STRING_OBJ:
+		return vm.executeBinaryStringOperation(op, left, right)
+	case leftType != rightType:
+		return fmt.Errorf("type mismatch: %s %s %s", leftType, operators[op], rightType)
+	default:
+		return fmt.Errorf("unknown operator: %s %s %s", leftType, operators[op], rightType)
+	}
+}
+
+func (vm *VM) executeBinaryIntegerOperation(op code.Opcode, left, right object.Object) error {
+	leftValue := left.(*object.Integer).Value
+	rightValue := right.(*object.Integer).Value
+
+	var result int64
+
+	switch op {
+	case code.OpAdd:
+		result = leftValue + rightValue
+	case code.OpSub:
+		result = leftValue - rightValue
+	case code.OpMul:
+		result = leftValue * rightValue
+	case code.OpDiv:
+		if rightValue == 0 {
+			return fmt.Errorf("division by zero: %d / %d", leftValue, rightValue)
+		}
+		result = leftValue / rightValue
+	case code.OpMod:
+		if rightValue == 0 {
+			return fmt.Errorf("division by zero: %d %% %d", leftValue, rightValue)
+		}
+		result = leftValue % rightValue
+	case code.OpBitAnd:
+		result = leftValue & rightValue
+	case code.OpBitOr:
+		result = leftValue | rightValue
+	case code.OpBitXor:
+		result = leftValue ^ rightValue
+	case code.OpShiftLeft, code.OpShiftRight:
+		if rightValue < 0 {
+			return fmt.Errorf("negative shift count: %d %s %d", leftValue, operators[op], rightValue)
+		}
+		if op == code.OpShiftLeft {
+			result = leftValue << rightValue
+		} else {
+			result = leftValue >> rightValue
+		}
+	default:
+		return fmt.Errorf("unknown integer operator: %d", op)
+	}
+
+	return vm.push(&object.Integer{Value: result})
+}
+
+// executeBinaryFloatOperation handles two floats, or a float and an integer
+// which is converted to a float first
+func (vm *VM) executeBinaryFloatOperation(op code.Opcode, left, right object.Object) error {
+	leftValue := floatValue(left)
+	rightValue := floatValue(right)
+
+	var result float64
+
+	switch op {
+	case code.OpAdd:
+		result = leftValue + rightValue
+	case code.OpSub:
+		result = leftValue - rightValue
+	case code.OpMul:
+		result = leftValue * rightValue
+	case code.OpDiv:
+		if rightValue == 0 {
+			return fmt.Errorf("division by zero: %s / %s", left.Inspect(), right.Inspect())
+		}
+		result = leftValue / rightValue
+	case code.OpMod:
+		if rightValue == 0 {
+			return fmt.Errorf("division by zero: %s %% %s", left.Inspect(), right.Inspect())
+		}
+		result = math.Mod(leftValue, rightValue)
+	default:
+		return fmt.Errorf("unknown operator: %s %s %s", left.Type(), operators[op], right.Type())
+	}
+
+	return vm.push(&object.Float{Value: result})
+}
+
+func (vm *VM) executeBinaryStringOperation(op code.Opcode, left, right object.Object) error {
+	if op != code.OpAdd {
+		return fmt.Errorf("unknown operator: %s %s %s", left.Type(), operators[op], right.Type())
+	}
+
+	leftValue := left.(*object.String).Value
+	rightValue := right.(*object.String).Value
+
+	return vm.push(&object.String{Value: leftValue + rightValue})
+}
+
+func (vm *VM) executeComparison(op code.Opcode) error {
+	right := vm.pop()
+	left := vm.pop()
+
+	switch {
+	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
+		return vm.executeIntegerComparison(op, left, right)
+	case isNumber(left) && isNumber(right):
+		return vm.executeFloatComparison(op, left, right)
+	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ && (op == code.OpEqual || op == code.OpNotEqual):
+		equal := left.(*object.String).Value == right.(*object.String).Value
+		return vm.push(nativeBoolToBooleanObject(equal == (op == code.OpEqual)))
+	}
+
+	// booleans and null are singletons, so pointer comparison is enough here
+	switch op {
+	case code.OpEqual:
+		return vm.push(nativeBoolToBooleanObject(right == left))
+	case code.OpNotEqual:
+		return vm.push(nativeBoolToBooleanObject(right != left))
+	default:
+		if left.Type() != right.Type() {
+			return fmt.Errorf("type mismatch: %s %s %s", left.Type(), operators[op], right.Type())
+		}
+		return fmt.Errorf("unknown operator: %s %s %s", left.Type(), operators[op], right.Type())
+	}
+}
+
+func (vm *VM) executeIntegerComparison(op code.Opcode, left, right object.Object) error {
+	leftValue := left.(*object.Integer).Value
+	rightValue := right.(*object.Integer).Value
+
+	switch op {
+	case code.OpEqual:
+		return vm.push(nativeBoolToBooleanObject(rightValue == leftValue))
+	case code.OpNotEqual:
+		return vm.push(nativeBoolToBooleanObject(rightValue != leftValue))
+	case code.OpGreaterThan:
+		return vm.push(nativeBoolToBooleanObject(leftValue > rightValue))
+	case code.OpGreaterThanOrEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue >= rightValue))
+	case code.OpLessThan:
+		return vm.push(nativeBoolToBooleanObject(leftValue < rightValue))
+	case code.OpLessThanOrEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue <= rightValue))
+	default:
+		return fmt.Errorf("unknown operator: %d", op)
+	}
+}
+
+func (vm *VM) executeFloatComparison(op code.Opcode, left, right object.Object) error {
+	leftValue := floatValue(left)
+	rightValue := floatValue(right)
+
+	switch op {
+	case code.OpEqual:
+		return vm.push(nativeBoolToBooleanObject(rightValue == leftValue))
+	case code.OpNotEqual:
+		return vm.push(nativeBoolToBooleanObject(rightValue != leftValue))
+	case code.OpGreaterThan:
+		return vm.push(nativeBoolToBooleanObject(leftValue > rightValue))
+	case code.OpGreaterThanOrEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue >= rightValue))
+	case code.OpLessThan:
+		return vm.push(nativeBoolToBooleanObject(leftValue < rightValue))
+	case code.OpLessThanOrEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue <= rightValue))
+	default:
+		return fmt.Errorf("unknown operator: %d", op)
+	}
+}
+
+func (vm *VM) executeBangOperator() error {
+	operand := vm.pop()
+
+	switch operand {
+	case True:
+		return vm.push(False)
+	case False:
+		return vm.push(True)
+	case Null:
+		return vm.push(True)
+	default:
+		return vm.push(False)
+	}
+}
+
+func (vm *VM) executeMinusOperator() error {
+	operand := vm.pop()
+
+	switch operand := operand.(type) {
+	case *object.Integer:
+		return vm.push(&object.Integer{Value: -operand.Value})
+	case *object.Float:
+		return vm.push(&object.Float{Value: -operand.Value})
+	default:
+		return fmt.Errorf("unknown operator: -%s", operand.Type())
+	}
+}
+
+func isNumber(obj object.Object) bool {
+	return obj.Type() == object.INTEGER_OBJ || obj.Type() == object.FLOAT_OBJ
+}
+
+func floatValue(obj object.Object) float64 {
+	if i, ok := obj.(*object.Integer); ok {
+		return float64(i.Value)
+	}
+	return obj.(*object.Float).Value
+}
+
+func (vm *VM) buildArray(startIndex, endIndex int) object.Object {
+	elements := make([]object.Object, endIndex-startIndex)
+
+	for i := startIndex; i < endIndex; i++ {
+		elements[i-startIndex] = vm.stack[i]
+	}
+
+	return &object.Array{Elements: elements}
+}
+
+func (vm *VM) buildHash(startIndex, endIndex int) (object.Object, error) {
+	hashedPairs := make(map[object.HashKey]object.HashPair)
+
+	for i := startIndex; i < endIndex; i += 2 {
+		key := vm.stack[i]
+		value := vm.stack[i+1]
+
+		pair := object.HashPair{Key: key, Value: value}
+
+		hashKey, ok := key.(object.Hashable)
+		if !ok {
+			return nil, fmt.Errorf("unusable as hash key: %s", key.Type())
+		}
+
+		hashedPairs[hashKey.HashKey()] = pair
+	}
+
+	return &object.Hash{Pairs: hashedPairs}, nil
+}
+
+func (vm *VM) executeIndexExpression(left, index object.Object) error {
+	switch {
+	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
+		return vm.executeArrayIndex(left, index)
+	case left.Type() == object.HASH_OBJ:
+		return vm.executeHashIndex(left, index)
+	default:
+		return fmt.Errorf("index operator not supported: %s[%s]", left.Type(), index.Type())
+	}
+}
+
+func (vm *VM) executeArrayIndex(array, index object.Object) error {
+	arrayObject := array.(*object.Array)
+	i := index.(*object.Integer).Value
+	max := int64(len(arrayObject.Elements) - 1)
+
+	if i < 0 || i > max {
+		return vm.push(Null)
+	}
+
+	return vm.push(arrayObject.Elements[i])
+}
+
+func (vm *VM) executeHashIndex(hash, index object.Object) error {
+	hashObject := hash.(*object.Hash)
+
+	key, ok := index.(object.Hashable)
+	if !ok {
+		return fmt.Errorf("unusable as hash key: %s", index.Type())
+	}
+
+	pair, ok := hashObject.Pairs[key.HashKey()]
+	if !ok {
+		return vm.push(Null)
+	}
+
+	return vm.push(pair.Value)
+}
+
+func (vm *VM) executeCall(numArgs int) error {
+	callee := vm.stack[vm.sp-1-numArgs]
+	switch callee := callee.(type) {
+	case *object.Closure:
+		return vm.callClosure(callee, numArgs)
+	case *object.Builtin:
+		return vm.callBuiltin(callee, numArgs)
+	default:
+		return fmt.Errorf("not a function: %s", callee.Type())
+	}
+}
+
+func (vm *VM) callClosure(cl *object.Closure, numArgs int) error {
+	if numArgs != cl.Fn.NumParameters {
+		return fmt.Errorf("wrong number of arguments: want=%d, got=%d", cl.Fn.NumParameters, numArgs)
+	}
+
+	// the arguments already on the stack become the first locals. The stack
+	// is checked first so a failing call is reported from the caller's frame
+	frame := NewFrame(cl, vm.sp-numArgs)
+	if frame.basePointer+cl.Fn.NumLocals >= StackSize {
+		return fmt.Errorf("stack overflow")
+	}
+	if err := vm.pushFrame(frame); err != nil {
+		return err
+	}
+
+	vm.sp = frame.basePointer + cl.Fn.NumLocals
+	return nil
+}
+
+func (vm *VM) callBuiltin(builtin *object.Builtin, numArgs int) error {
+	args := vm.stack[vm.sp-numArgs : vm.sp]
+
+	result := builtin.Call(args...)
+	vm.sp = vm.sp - numArgs - 1
+
+	if err, ok := result.(*object.Error); ok {
+		return fmt.Errorf("%s", err.Message)
+	}
+
+	if result != nil {
+		return vm.push(result)
+	}
+	return vm.push(Null)
+}
+
+func (vm *VM) pushClosure(constIndex int, numFree int) error {
+	constant := vm.constants[constIndex]
+	function, ok := constant.(*object.CompiledFunction)
+	if !ok {
+		return fmt.Errorf("not a function: %+v", constant)
+	}
+
+	free := make([]object.Object, numFree)
+	for i := 0; i < numFree; i++ {
+		free[i] = vm.stack[vm.sp-numFree+i]
+	}
+	vm.sp = vm.sp - numFree
+
+	closure := &object.Closure{Fn: function, Free: free}
+	return vm.push(closure)
+}
+
+// operators maps opcodes back to the operator they were compiled from, so the
+// VM can report the same errors as the evaluator
+var operators = map[code.Opcode]string{
+	code.OpAdd:                "+",
+	code.OpSub:                "-",
+	code.OpMul:                "*",
+	code.OpDiv:                "/",
+	code.OpMod:                "%",
+	code.OpBitAnd:             "&",
+	code.OpBitOr:              "|",
+	code.OpBitXor:             "^",
+	code.OpShiftLeft:          "<<",
+	code.OpShiftRight:         ">>",
+	code.OpEqual:              "==",
+	code.OpNotEqual:           "!=",
+	code.OpGreaterThan:        ">",
+	code.OpGreaterThanOrEqual: ">=",
+	code.OpLessThan:           "<",
+	code.OpLessThanOrEqual:    "<=",
+}
+
+func isTruthy(obj object.Object) bool {
+	switch obj := obj.(type) {
+	case *object.Boolean:
+		return obj.Value
+	case *object.Null:
+		return false
+	default:
+		return true
+	}
+}
+
+func nativeBoolToBooleanObject(input bool) *object.Boolean {
+	if input {
+		return True
+	}
+	return False
+}
@@ -0,0 +1,448 @@
+package vm
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"waiig/ast"
+	"waiig/compiler"
+	"waiig/lexer"
+	"waiig/object"
+	"waiig/parser"
+	"waiig/token"
+)
+
+type vmTestCase struct {
+	input    string
+	expected interface{}
+}
+
+func TestIntegerArithmetic(t *testing.T) {
+	tests := []vmTestCase{
+		{"1", 1},
+		{"2", 2},
+		{"1 + 2", 3},
+		{"1 - 2", -1},
+		{"4 / 2", 2},
+		{"50 / 2 * 2 + 10 - 5", 55},
+		{"5 * (2 + 10)", 60},
+		{"-5", -5},
+		{"-50 + 100 + -50", 0},
+		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestFloatArithmetic(t *testing.T) {
+	tests := []vmTestCase{
+		{"0x10 + 0b1", 17},
+		{"1.5 + 1.5", 3.0},
+		{"1 + 0.5", 1.5},
+		{"-2.5 * 2", -5.0},
+		{"7 / 2.0", 3.5},
+		{"1_000 / 1e2", 10.0},
+		{"1 < 1.5", true},
+		{"2.5 > 2", true},
+		{"1 == 1.0", true},
+		{"1.5 != 1.5", false},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestOperators(t *testing.T) {
+	tests := []vmTestCase{
+		{"7 % 3", 1},
+		{"-7 % 3", -1},
+		{"5.5 % 2", 1.5},
+		{"6 & 3", 2},
+		{"6 | 3", 7},
+		{"6 ^ 3", 5},
+		{"1 << 2 + 1", 8},
+		{"-16 >> 2", -4},
+		{"1 <= 1", true},
+		{"2 <= 1", false},
+		{"1 >= 1.5", false},
+		{"2.5 >= 2", true},
+		{"true && true", true},
+		{"true && false", false},
+		{"false || true", true},
+		{"false || false", false},
+		{"1 && \"\"", true},
+		{"if (false) { 1 } || 0", true},
+		{"1 < 2 && 2 < 3 || false", true},
+		// f(0) would divide by zero if && didn't short circuit
+		{"let f = fn(x) { if (x > 0 && 10 / x > 1) { 1 } else { 0 } }; [f(0), f(5), f(20)]", []int{0, 1, 0}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestOperatorErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"5 % 0", "1:3: division by zero: 5 % 0"},
+		{"1 << -1", "1:3: negative shift count: 1 << -1"},
+		{"1.5 & 1", "1:5: unknown operator: FLOAT & INTEGER"},
+		{"true | false", "1:6: unknown operator: BOOLEAN | BOOLEAN"},
+		{"false || 1 % 0", "1:12: division by zero: 1 % 0"},
+	}
+
+	for _, tt := range tests {
+		comp := compiler.New()
+		if err := comp.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		err := New(comp.Bytecode()).Run()
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("%q: wrong error. want=%q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func TestBooleanExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{"true", true},
+		{"false", false},
+		{"1 < 2", true},
+		{"1 > 2", false},
+		{"1 == 1", true},
+		{"1 != 1", false},
+		{"true == false", false},
+		{"(1 < 2) == true", true},
+		{`"a" == "a"`, true},
+		{`"a" != "b"`, true},
+		{"!true", false},
+		{"!5", false},
+		{"!!5", true},
+		{"!(if (false) { 5; })", true},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestConditionals(t *testing.T) {
+	tests := []vmTestCase{
+		{"if (true) { 10 }", 10},
+		{"if (1 < 2) { 10 } else { 20 }", 10},
+		{"if (1 > 2) { 10 } else { 20 }", 20},
+		{"if (1 > 2) { 10 }", Null},
+		{"if (false) { 10 }", Null},
+		{"if ((if (false) { 10 })) { 10 } else { 20 }", 20},
+		{"if (true) { let a = 1; }", Null},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestGlobalLetStatements(t *testing.T) {
+	tests := []vmTestCase{
+		{"let one = 1; one", 1},
+		{"let one = 1; let two = one + one; one + two", 3},
+		{"let a = 1; let a = a + 1; a", 2},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestReturnStatements(t *testing.T) {
+	tests := []vmTestCase{
+		{"return 10; 9;", 10},
+		{"9; return 2 * 5; 9;", 10},
+		{"if (10 > 1) { if (10 > 1) { return 10; } return 1; }", 10},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestStringsArraysAndHashes(t *testing.T) {
+	tests := []vmTestCase{
+		{`"mon" + "key"`, "monkey"},
+		{"[]", []int{}},
+		{"[1 + 2, 3 * 4]", []int{3, 12}},
+		{"[1, 2, 3][1]", 2},
+		{"[1, 2, 3][3]", Null},
+		{"[1, 2, 3][-1]", Null},
+		{"{1: 2, 2: 3}[1]", 2},
+		{"{1: 1}[0]", Null},
+		{`{"one": 1 + 1}["one"]`, 2},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestCallingFunctions(t *testing.T) {
+	tests := []vmTestCase{
+		{"let fivePlusTen = fn() { 5 + 10; }; fivePlusTen();", 15},
+		{"let noReturn = fn() { }; noReturn();", Null},
+		{"let earlyExit = fn() { return 99; 100; }; earlyExit();", 99},
+		{"let identity = fn(a) { a; }; identity(4);", 4},
+		{"let sum = fn(a, b) { let c = a + b; c; }; sum(1, 2);", 3},
+		{"let globalNum = 10; let sum = fn(a, b) { let c = a + b; c + globalNum; }; sum(1, 2) + sum(3, 4);", 30},
+		{"let returnsOne = fn() { 1; }; let returnsOneReturner = fn() { returnsOne; }; returnsOneReturner()();", 1},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestBuiltinFunctions(t *testing.T) {
+	tests := []vmTestCase{
+		{`len("")`, 0},
+		{`len("four")`, 4},
+		{`len([1, 2, 3])`, 3},
+		{`first([1, 2, 3])`, 1},
+		{`first([])`, Null},
+		{`last([1, 2, 3])`, 3},
+		{`rest([1, 2, 3])`, []int{2, 3}},
+		{`push([], 1)`, []int{1}},
+		{`puts("hello")`, Null},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestClosures(t *testing.T) {
+	tests := []vmTestCase{
+		{"let newClosure = fn(a) { fn() { a; }; }; let closure = newClosure(99); closure();", 99},
+		{"let newAdder = fn(a, b) { fn(c) { a + b + c }; }; let adder = newAdder(1, 2); adder(8);", 11},
+		{`
+		let newAdderOuter = fn(a, b) {
+			let c = a + b;
+			fn(d) {
+				let e = d + c;
+				fn(f) { e + f; };
+			};
+		};
+		let newAdderInner = newAdderOuter(1, 2);
+		let adder = newAdderInner(3);
+		adder(8);
+		`, 14},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestRecursiveFunctions(t *testing.T) {
+	tests := []vmTestCase{
+		{"let countDown = fn(x) { if (x == 0) { return 0; } else { countDown(x - 1); } }; countDown(1);", 0},
+		{`
+		let wrapper = fn() {
+			let countDown = fn(x) { if (x == 0) { return 0; } else { countDown(x - 1); } };
+			countDown(1);
+		};
+		wrapper();
+		`, 0},
+		{`
+		let fibonacci = fn(x) {
+			if (x == 0) { return 0; }
+			if (x == 1) { return 1; }
+			fibonacci(x - 1) + fibonacci(x - 2);
+		};
+		fibonacci(15);
+		`, 610},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestRuntimeErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"5 + true;", "1:3: type mismatch: INTEGER + BOOLEAN"},
+		{"-true", "1:1: unknown operator: -BOOLEAN"},
+		{"true + false;", "1:6: unknown operator: BOOLEAN + BOOLEAN"},
+		{`"Hello" - "World"`, "1:9: unknown operator: STRING - STRING"},
+		{"1 / 0", "1:3: division by zero: 1 / 0"},
+		{`{"name": "Monkey"}[fn(x) { x }];`, "1:19: unusable as hash key: CLOSURE"},
+		{"1[0]", "1:2: index operator not supported: INTEGER[INTEGER]"},
+		{"fn() { 1; }(1);", "1:12: wrong number of arguments: want=0, got=1"},
+		{"5();", "1:2: not a function: INTEGER"},
+		{`len(1)`, "1:4: argument 1 to `len` must be STRING or ARRAY or HASH, got INTEGER"},
+		{"let f = fn() { f() }; f();", "1:17: maximum recursion depth exceeded: 1023 nested calls"},
+		{`1 < "a"`, "1:3: type mismatch: INTEGER < STRING"},
+		{`"a" <= "b"`, "1:5: unknown operator: STRING <= STRING"},
+		{"let a = fn() { 1 / 0 }; let b = fn() { -true }; a() < b()", "1:18: division by zero: 1 / 0"},
+		{"let f = fn(x) {\n  x + 1\n};\nf(true)", "2:5: type mismatch: BOOLEAN + INTEGER"},
+	}
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+
+		comp := compiler.New()
+		if err := comp.Compile(program); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		err := vm.Run()
+		if err == nil {
+			t.Errorf("expected VM error for %q but resulted in none", tt.input)
+			continue
+		}
+
+		if err.Error() != tt.expected {
+			t.Errorf("wrong VM error for %q. want=%q, got=%q", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func TestRuntimeErrorStack(t *testing.T) {
+	input := `let inc = fn(x) { x + true };
+let twice = fn(f, x) { f(f(x)) };
+twice(inc, 1)`
+
+	comp := compiler.New()
+	if err := comp.Compile(parse(input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	err, ok := New(comp.Bytecode()).Run().(*Error)
+	if !ok {
+		t.Fatalf("no *Error. got=%T", err)
+	}
+
+	expected := []object.Frame{
+		{Function: "inc", Pos: token.Position{Offset: 56, Line: 2, Column: 27}},
+		{Function: "twice", Pos: token.Position{Offset: 69, Line: 3, Column: 6}},
+	}
+	if !reflect.DeepEqual(err.Stack, expected) {
+		t.Errorf("wrong stack. want=%+v, got=%+v", expected, err.Stack)
+	}
+}
+
+func TestGlobalsAcrossRuns(t *testing.T) {
+	constants := []object.Object{}
+	globals := NewGlobalsStore()
+	symbolTable := compiler.NewSymbolTableWithBuiltins()
+
+	inputs := []vmTestCase{
+		{"let a = 5;", nil},
+		{"let double = fn(x) { x * 2 };", nil},
+		{"double(a)", 10},
+	}
+
+	for _, tt := range inputs {
+		comp := compiler.NewWithState(symbolTable, constants)
+		if err := comp.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		code := comp.Bytecode()
+		constants = code.Constants
+
+		vm := NewWithGlobalsStore(code, globals)
+		if err := vm.Run(); err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+
+		if tt.expected != nil {
+			testExpectedObject(t, tt.expected, vm.LastPoppedStackElem())
+		}
+	}
+}
+
+// helpers
+
+func runVmTests(t *testing.T, tests []vmTestCase) {
+	t.Helper()
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+
+		comp := compiler.New()
+		if err := comp.Compile(program); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		if err := vm.Run(); err != nil {
+			t.Fatalf("vm error for %q: %s", tt.input, err)
+		}
+
+		stackElem := vm.LastPoppedStackElem()
+
+		testExpectedObject(t, tt.expected, stackElem)
+	}
+}
+
+func parse(input string) *ast.Program {
+	l := lexer.New(input)
+	p := parser.New(l)
+	return p.ParseProgram()
+}
+
+func testExpectedObject(t *testing.T, expected interface{}, actual object.Object) {
+	t.Helper()
+
+	switch expected := expected.(type) {
+	case int:
+		if err := testIntegerObject(int64(expected), actual); err != nil {
+			t.Errorf("testIntegerObject failed: %s", err)
+		}
+	case float64:
+		float, ok := actual.(*object.Float)
+		if !ok || float.Value != expected {
+			t.Errorf("object is not Float %g. got=%T (%+v)", expected, actual, actual)
+		}
+	case bool:
+		if err := testBooleanObject(expected, actual); err != nil {
+			t.Errorf("testBooleanObject failed: %s", err)
+		}
+	case string:
+		str, ok := actual.(*object.String)
+		if !ok || str.Value != expected {
+			t.Errorf("object is not String %q. got=%T (%+v)", expected, actual, actual)
+		}
+	case []int:
+		array, ok := actual.(*object.Array)
+		if !ok {
+			t.Errorf("object not Array: %T (%+v)", actual, actual)
+			return
+		}
+		if len(array.Elements) != len(expected) {
+			t.Errorf("wrong num of elements. want=%d, got=%d", len(expected), len(array.Elements))
+			return
+		}
+		for i, el := range expected {
+			if err := testIntegerObject(int64(el), array.Elements[i]); err != nil {
+				t.Errorf("testIntegerObject failed: %s", err)
+			}
+		}
+	case *object.Null:
+		if actual != Null {
+			t.Errorf("object is not Null: %T (%+v)", actual, actual)
+		}
+	}
+}
+
+func testIntegerObject(expected int64, actual object.Object) error {
+	result, ok := actual.(*object.Integer)
+	if !ok {
+		return fmt.Errorf("object is not Integer. got=%T (%+v)", actual, actual)
+	}
+
+	if result.Value != expected {
+		return fmt.Errorf("object has wrong value. got=%d, want=%d", result.Value, expected)
+	}
+
+	return nil
+}
+
+func testBooleanObject(expected bool, actual object.Object) error {
+	result, ok := actual.(*object.Boolean)
+	if !ok {
+		return fmt.Errorf("object is not Boolean. got=%T (%+v)", actual, actual)
+	}
+
+	if result.Value != expected {
+		return fmt.Errorf("object has wrong value. got=%t, want=%t", result.Value, expected)
+	}
+
+	return nil
+}
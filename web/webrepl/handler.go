@@ -3,23 +3,104 @@ package webrepl
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"strings"
+	"waiig/evaluator"
 	"waiig/lexer"
+	"waiig/object"
+	"waiig/parser"
 	"waiig/token"
 	"waiig/web/view"
 
 	"github.com/labstack/echo/v4"
 )
 
-func HandleEvaluate(c echo.Context) error {
-	l := lexer.New(c.FormValue("in"))
+// input starting with this prefix is shown as tokens instead of evaluated
+const tokensPrefix = ":tokens"
 
-	out := ""
-	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
-		out += fmt.Sprintf("%+v\n", tok)
+// the cookie that holds the id of the visitor's session
+const sessionCookie = "waiig_session"
+
+// Handler serves the web REPL, every browser gets its own session. Anyone can
+// send code, so every evaluation runs within the limits
+type Handler struct {
+	store  *Store
+	limits evaluator.Limits
+}
+
+func NewHandler(store *Store, limits evaluator.Limits) *Handler {
+	return &Handler{store: store, limits: limits}
+}
+
+func (h *Handler) HandleEvaluate(c echo.Context) error {
+	in := c.FormValue("in")
+
+	var output, out string
+	if rest, ok := strings.CutPrefix(strings.TrimSpace(in), tokensPrefix); ok {
+		out = tokens(strings.TrimSpace(rest))
+	} else {
+		output, out = evaluate(c.Request().Context(), h.session(c), in, h.limits)
 	}
-	return view.Print(out).Render(context.Background(), c.Response())
+
+	return view.Print(in, output, out).Render(context.Background(), c.Response())
 }
 
-func HandleIndex(c echo.Context) error {
+func (h *Handler) HandleIndex(c echo.Context) error {
 	return view.Index().Render(context.Background(), c.Response())
 }
+
+// HandleReset drops the visitor's session and starts over with an empty page
+func (h *Handler) HandleReset(c echo.Context) error {
+	if cookie, err := c.Cookie(sessionCookie); err == nil {
+		h.store.Delete(cookie.Value)
+	}
+	return c.Redirect(http.StatusSeeOther, "/")
+}
+
+// session returns the visitor's session, starting a new one when the cookie
+// is missing or the session it names has expired
+func (h *Handler) session(c echo.Context) *Session {
+	id := ""
+	if cookie, err := c.Cookie(sessionCookie); err == nil {
+		id = cookie.Value
+	}
+
+	session := h.store.Get(id)
+	if session.ID != id {
+		c.SetCookie(&http.Cookie{
+			Name:     sessionCookie,
+			Value:    session.ID,
+			Path:     "/",
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+	return session
+}
+
+// evaluate runs the input in the session and returns what the program printed
+// and what the REPL would print for it, cut off after maxOutput bytes
+func evaluate(ctx context.Context, session *Session, in string, limits evaluator.Limits) (string, string) {
+	p := parser.New(lexer.New(in))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return "", parser.Diagnostics(in, p.Errors())
+	}
+
+	result, output := session.Eval(ctx, program, limits)
+	if result == nil {
+		return output, ""
+	}
+	// a value can take far more bytes to print than to hold
+	return output, object.InspectN(result, maxOutput)
+}
+
+func tokens(in string) string {
+	l := lexer.New(in)
+
+	out := ""
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		out += fmt.Sprintf("%s\t%s\t%q\n", tok.Pos, tok.Type, tok.Literal)
+	}
+	return out
+}
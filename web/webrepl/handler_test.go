@@ -0,0 +1,202 @@
+package webrepl
+
+import (
+	"html"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+	"waiig/evaluator"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestHandleEvaluate(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 + 2 * 3", "<pre>7</pre>"},
+		{`let s = "mon"; s + "key"`, "<pre>monkey</pre>"},
+		{"let x = 1;", "<pre></pre>"},
+		{"5 + true", "<pre>ERROR: 1:3: type mismatch: INTEGER + BOOLEAN</pre>"},
+		{"let = 5;", "<pre>1:5: Expected IDENT, got =\nlet = 5;\n    ^</pre>"},
+		{":tokens let x", "<pre>1:1\tLET\t\"let\"\n1:5\tIDENT\t\"x\"\n</pre>"},
+		{`puts("hi", 2); 3`, "<pre>hi\n2\n</pre><pre>3</pre>"},
+		{`puts("<b>")`, "<pre><b>\n</pre><pre>null</pre>"},
+	}
+
+	h := NewHandler(NewStore(time.Hour, 10, 0), evaluator.Limits{})
+
+	for _, tt := range tests {
+		rec := post(t, h.HandleEvaluate, tt.input, nil)
+		body := html.UnescapeString(rec.Body.String())
+
+		if !strings.Contains(body, tt.expected) {
+			t.Errorf("wrong result for %q.\nwant=%q\ngot =%q", tt.input, tt.expected, body)
+		}
+		if !strings.Contains(body, ">> "+tt.input) {
+			t.Errorf("input %q isn't echoed. got=%q", tt.input, body)
+		}
+		if !strings.Contains(body, `<textarea`) {
+			t.Errorf("no prompt after the result of %q", tt.input)
+		}
+	}
+}
+
+func TestSessionsAreKeptPerBrowser(t *testing.T) {
+	h := NewHandler(NewStore(time.Hour, 10, 0), evaluator.Limits{})
+
+	first := post(t, h.HandleEvaluate, "let x = 1;", nil)
+	cookie := sessionCookieOf(t, first)
+
+	rec := post(t, h.HandleEvaluate, "x + 1", cookie)
+	if !strings.Contains(rec.Body.String(), "<pre>2</pre>") {
+		t.Errorf("binding not kept in the session. got=%q", rec.Body.String())
+	}
+	if len(rec.Result().Cookies()) != 0 {
+		t.Errorf("cookie set again for an existing session")
+	}
+
+	// another browser doesn't see x
+	rec = post(t, h.HandleEvaluate, "x", nil)
+	if !strings.Contains(rec.Body.String(), "identifier not found: x") {
+		t.Errorf("binding leaked into another session. got=%q", rec.Body.String())
+	}
+
+	rec = post(t, h.HandleReset, "", cookie)
+	if rec.Code != http.StatusSeeOther {
+		t.Errorf("reset should redirect. got=%d", rec.Code)
+	}
+
+	rec = post(t, h.HandleEvaluate, "x", cookie)
+	if !strings.Contains(rec.Body.String(), "identifier not found: x") {
+		t.Errorf("binding survived the reset. got=%q", rec.Body.String())
+	}
+	if sessionCookieOf(t, rec).Value == cookie.Value {
+		t.Errorf("reset session got the old id back")
+	}
+}
+
+func TestHandleEvaluateTruncatesOutput(t *testing.T) {
+	h := NewHandler(NewStore(time.Hour, 10, 0), evaluator.Limits{})
+
+	input := `let loop = fn(n) { if (n > 0) { puts("0123456789abcdef"); loop(n - 1) } }; loop(10000)`
+	body := post(t, h.HandleEvaluate, input, nil).Body.String()
+
+	if !strings.Contains(body, "\n[output truncated]\n</pre>") {
+		t.Fatalf("output isn't truncated. got %d bytes", len(body))
+	}
+	if len(body) > 2*maxOutput {
+		t.Errorf("too much output. got %d bytes", len(body))
+	}
+}
+
+func post(t *testing.T, handler echo.HandlerFunc, input string, cookie *http.Cookie) *httptest.ResponseRecorder {
+	t.Helper()
+
+	form := url.Values{"in": {input}}
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	rec := httptest.NewRecorder()
+
+	c := echo.New().NewContext(req, rec)
+	if err := handler(c); err != nil {
+		t.Fatalf("handler failed: %s", err)
+	}
+
+	return rec
+}
+
+func sessionCookieOf(t *testing.T, rec *httptest.ResponseRecorder) *http.Cookie {
+	t.Helper()
+
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == sessionCookie {
+			return c
+		}
+	}
+	t.Fatalf("no session cookie in the response")
+	return nil
+}
+
+func TestEvaluationLimits(t *testing.T) {
+	limits := evaluator.Limits{MaxSteps: 1000, MaxCallDepth: 50}
+	h := NewHandler(NewStore(time.Hour, 10, 0), limits)
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let f = fn() { f() }; f()", "LIMIT EXCEEDED: 1:17: maximum recursion depth exceeded: 50 nested calls"},
+		{"let loop = fn(n) { if (n > 0) { loop(n - 1) } }; loop(40); loop(40); loop(40); loop(40)", "step limit exceeded: 1000 steps"},
+		{"let ok = fn(n) { if (n > 0) { ok(n - 1) } else { 42 } }; ok(20)", "<pre>42</pre>"},
+	}
+
+	for _, tt := range tests {
+		rec := post(t, h.HandleEvaluate, tt.input, nil)
+		body := html.UnescapeString(rec.Body.String())
+
+		if !strings.Contains(body, tt.expected) {
+			t.Errorf("wrong result for %q.\nwant=%q\ngot =%q", tt.input, tt.expected, body)
+		}
+	}
+}
+
+func TestHandleEvaluateBoundsRendering(t *testing.T) {
+	h := NewHandler(NewStore(time.Hour, 10, 0), evaluator.Limits{})
+
+	// a takes 23 arrays in memory, printing it takes 2^22 ones
+	doubling := "let a=[1];" + strings.Repeat("let a=[a,a];", 22)
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{doubling + "a", "[[[[[[[[[[[[[[[[[[[[[[[1], [1]], "},
+		{doubling + "puts(a)", "\n[output truncated]\n</pre>"},
+	}
+
+	for _, tt := range tests {
+		start := time.Now()
+		body := post(t, h.HandleEvaluate, tt.input, nil).Body.String()
+
+		if !strings.Contains(html.UnescapeString(body), tt.expected) {
+			t.Errorf("wrong result for %q. want=%q", tt.input, tt.expected)
+		}
+		if len(body) > 3*maxOutput {
+			t.Errorf("too much output for %q. got %d bytes", tt.input, len(body))
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("rendering %q took %s", tt.input, elapsed)
+		}
+	}
+}
+
+func TestSessionMemoryLimit(t *testing.T) {
+	h := NewHandler(NewStore(time.Hour, 10, 4<<10), evaluator.Limits{})
+
+	first := post(t, h.HandleEvaluate, "let x = 1; let a=[1];"+strings.Repeat("let a=[a,a];", 22), nil)
+	cookie := sessionCookieOf(t, first)
+
+	// the same array twice counts once
+	rec := post(t, h.HandleEvaluate, "x", cookie)
+	if !strings.Contains(rec.Body.String(), "<pre>1</pre>") {
+		t.Fatalf("session was reset. got=%q", rec.Body.String())
+	}
+
+	rec = post(t, h.HandleEvaluate, `let s = "0123456789abcdef";`+strings.Repeat("let s = s + s;", 8), cookie)
+	if !strings.Contains(rec.Body.String(), "LIMIT EXCEEDED: session memory limit exceeded: 4096 bytes, the session was reset") {
+		t.Errorf("session limit not reported. got=%q", rec.Body.String())
+	}
+
+	rec = post(t, h.HandleEvaluate, "x", cookie)
+	if !strings.Contains(rec.Body.String(), "identifier not found: x") {
+		t.Errorf("bindings survived the reset. got=%q", rec.Body.String())
+	}
+}
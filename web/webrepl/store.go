@@ -0,0 +1,169 @@
+package webrepl
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+	"waiig/ast"
+	"waiig/evaluator"
+	"waiig/object"
+	"waiig/repl"
+)
+
+// Session is the REPL session of one browser
+type Session struct {
+	ID string
+
+	mu       sync.Mutex // requests from the same browser can overlap
+	repl     *repl.Session
+	maxBytes int64
+	lastUsed time.Time
+}
+
+// Eval runs the program in the session, it returns the result along with what
+// the program printed
+func (s *Session) Eval(ctx context.Context, program *ast.Program, limits evaluator.Limits) (object.Object, string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var output outputBuffer
+	s.repl.SetOutput(&output)
+	defer s.repl.SetOutput(io.Discard)
+
+	result := s.repl.EvalContext(ctx, program, limits)
+
+	// bindings outlive the request, the limits only bound what a single
+	// input allocates
+	if s.maxBytes > 0 {
+		if size := s.repl.Footprint(); size > s.maxBytes {
+			s.repl.Reset()
+			result = &object.LimitError{Message: fmt.Sprintf("session memory limit exceeded: %d bytes, the session was reset", s.maxBytes)}
+		}
+	}
+
+	return result, output.String()
+}
+
+// maxOutput bounds what a single evaluation prints, the limits don't cover
+// it and the output is held in memory until the response is written
+const maxOutput = 64 << 10
+
+// outputBuffer keeps the first maxOutput bytes written to it. Writes fail once
+// it's full, so puts stops printing a value nobody gets to see
+type outputBuffer struct {
+	buf       bytes.Buffer
+	truncated bool
+}
+
+func (b *outputBuffer) Write(p []byte) (int, error) {
+	if room := maxOutput - b.buf.Len(); len(p) > room {
+		b.buf.Write(p[:room])
+		b.truncated = true
+		return room, errOutputFull
+	}
+	return b.buf.Write(p)
+}
+
+var errOutputFull = errors.New("output limit reached")
+
+func (b *outputBuffer) String() string {
+	if b.truncated {
+		return b.buf.String() + "\n[output truncated]\n"
+	}
+	return b.buf.String()
+}
+
+// Store keeps the sessions of all visitors. Sessions that are idle for longer
+// than the idle timeout are dropped, and once there are max sessions the one
+// used least recently makes room for a new one. A session whose bindings take
+// more than maxBytes is reset
+type Store struct {
+	mu       sync.Mutex
+	sessions map[string]*Session
+	idle     time.Duration
+	max      int
+	maxBytes int64
+
+	now func() time.Time // replaced in tests
+}
+
+func NewStore(idle time.Duration, max int, maxBytes int64) *Store {
+	return &Store{
+		sessions: make(map[string]*Session),
+		idle:     idle,
+		max:      max,
+		maxBytes: maxBytes,
+		now:      time.Now,
+	}
+}
+
+// Get returns the session with the given id, or a new session when there is
+// no such session or it has expired. Callers must check the ID of the result
+func (s *Store) Get(id string) *Session {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.expire(now)
+
+	if session, ok := s.sessions[id]; ok {
+		session.lastUsed = now
+		return session
+	}
+
+	if len(s.sessions) >= s.max {
+		s.evictLeastRecentlyUsed()
+	}
+
+	session := &Session{ID: newID(), repl: repl.NewSession(repl.EngineEval), maxBytes: s.maxBytes, lastUsed: now}
+	s.sessions[session.ID] = session
+	return session
+}
+
+// Delete drops the session with the given id, if there is one
+func (s *Store) Delete(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, id)
+}
+
+// Len returns the number of sessions in the store
+func (s *Store) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.sessions)
+}
+
+func (s *Store) expire(now time.Time) {
+	for id, session := range s.sessions {
+		if now.Sub(session.lastUsed) > s.idle {
+			delete(s.sessions, id)
+		}
+	}
+}
+
+func (s *Store) evictLeastRecentlyUsed() {
+	var oldest *Session
+	for _, session := range s.sessions {
+		if oldest == nil || session.lastUsed.Before(oldest.lastUsed) {
+			oldest = session
+		}
+	}
+	if oldest != nil {
+		delete(s.sessions, oldest.ID)
+	}
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,64 @@
+package webrepl
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStoreExpiresIdleSessions(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	store := NewStore(10*time.Minute, 10, 0)
+	store.now = func() time.Time { return now }
+
+	first := store.Get("")
+	if again := store.Get(first.ID); again != first {
+		t.Fatalf("existing session not returned")
+	}
+
+	now = now.Add(9 * time.Minute)
+	if again := store.Get(first.ID); again != first {
+		t.Fatalf("session expired before its idle timeout")
+	}
+
+	// using it again restarted the timeout
+	now = now.Add(9 * time.Minute)
+	if again := store.Get(first.ID); again != first {
+		t.Fatalf("session expired although it was used")
+	}
+
+	now = now.Add(11 * time.Minute)
+	if again := store.Get(first.ID); again == first || again.ID == first.ID {
+		t.Fatalf("idle session not expired")
+	}
+	if store.Len() != 1 {
+		t.Errorf("expired session still in the store. len=%d", store.Len())
+	}
+}
+
+func TestStoreEvictsLeastRecentlyUsed(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	store := NewStore(time.Hour, 2, 0)
+	store.now = func() time.Time { return now }
+
+	a := store.Get("")
+	now = now.Add(time.Second)
+	b := store.Get("")
+	now = now.Add(time.Second)
+	store.Get(a.ID)
+	now = now.Add(time.Second)
+
+	c := store.Get("")
+	if store.Len() != 2 {
+		t.Fatalf("store grew past its cap. len=%d", store.Len())
+	}
+
+	if store.Get(a.ID) != a {
+		t.Errorf("recently used session was evicted")
+	}
+	if store.Get(c.ID) != c {
+		t.Errorf("new session was evicted")
+	}
+	if store.Get(b.ID) == b {
+		t.Errorf("least recently used session wasn't evicted")
+	}
+}